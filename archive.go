@@ -0,0 +1,347 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// archiveSkipDirs are directories never sent for analysis, besides hidden
+// ones.
+var archiveSkipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	".next":        true,
+	"dist":         true,
+	"build":        true,
+	"vendor":       true,
+	"__pycache__":  true,
+	".venv":        true,
+}
+
+// archiveBinaryExts are extensions of files that carry no code to analyze.
+var archiveBinaryExts = map[string]bool{
+	".exe": true, ".dll": true, ".so": true, ".dylib": true,
+	".bin": true, ".obj": true, ".o": true, ".a": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true,
+	".ico": true, ".svg": true, ".webp": true,
+	".mp3": true, ".mp4": true, ".avi": true, ".mov": true,
+	".zip": true, ".tar": true, ".gz": true, ".bz2": true,
+	".rar": true, ".7z": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+	".pdf": true, ".doc": true, ".docx": true,
+}
+
+// archiveInFlightPerWorker bounds how many compressed entries may wait for
+// the writer per worker. Entries are at most maxFileSize before
+// compression, so memory stays below workers * this * maxFileSize even when
+// one slow file holds up the entries after it.
+const archiveInFlightPerWorker = 2
+
+// archiveModDate is the modification date of every entry, 1980-01-01 in
+// MS-DOS format, the earliest a zip header can hold, so archives of the same
+// files are byte-identical. CreateRaw writes the MS-DOS fields as given and
+// ignores FileHeader.Modified.
+const archiveModDate = 1<<5 | 1
+
+// flateWriters reuses compressors across files; a new one allocates far
+// more than most source files are long.
+var flateWriters = sync.Pool{New: func() interface{} {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return fw
+}}
+
+// archiveEntry is a file queued for compression, numbered in walk order.
+type archiveEntry struct {
+	seq  int
+	path string
+	rel  string
+	d    fs.DirEntry
+	info fs.FileInfo // of the target, for a followed symlink
+
+	header *zip.FileHeader // nil if the file was skipped
+	data   []byte          // deflated content
+}
+
+// createRepoZip walks the workspace directory and writes a zip archive to
+// zipPath. It skips .git/, node_modules/, binary files, files > 10MB, and
+// skipDir, the work directory if it is inside the workspace. Symlinks to
+// regular files inside the workspace are archived as the file; other
+// symlinks are skipped.
+//
+// The archive is canonical: entries are sorted by their slash-separated
+// name, with a fixed timestamp and 0644 or 0755 permissions, so the same
+// files always give the same bytes with the same build, and the same
+// archiveDigest with any build.
+//
+// Files are stat'ed, read and deflated by a pool of workers, one per CPU.
+// A single writer adds them with CreateRaw in name order, so the archive is
+// the same however the work was scheduled.
+func createRepoZip(ctx context.Context, workspaceDir, zipPath, skipDir string) error {
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("creating archive: %w", err)
+	}
+	defer zipFile.Close()
+	zw := zip.NewWriter(zipFile)
+
+	workers := runtime.NumCPU()
+	// slots is taken for every entry before it is queued and released once
+	// it is written, bounding the entries held in memory.
+	slots := make(chan struct{}, workers*archiveInFlightPerWorker)
+	jobs := make(chan *archiveEntry)
+	done := make(chan *archiveEntry)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				e.header, e.data = deflateEntry(e)
+				done <- e
+			}
+		}()
+	}
+
+	// The writer reorders finished entries by sequence number.
+	written := 0
+	writeErr := make(chan error, 1)
+	go func() {
+		pending := map[int]*archiveEntry{}
+		next := 0
+		var err error
+		for e := range done {
+			pending[e.seq] = e
+			for e := pending[next]; e != nil; e = pending[next] {
+				delete(pending, next)
+				next++
+				if err == nil && e.header != nil {
+					err = writeRawEntry(zw, e)
+					if err == nil {
+						written++
+					}
+				}
+				<-slots
+			}
+		}
+		writeErr <- err
+	}()
+
+	workspaceRoot, err := filepath.EvalSymlinks(workspaceDir)
+	if err != nil {
+		workspaceRoot = workspaceDir
+	}
+	var entries []*archiveEntry
+	walkErr := filepath.WalkDir(workspaceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip errors
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		relPath, err := filepath.Rel(workspaceDir, path)
+		if err != nil || relPath == "." {
+			return nil
+		}
+
+		// Skip hidden dirs and known large dirs
+		baseName := d.Name()
+		if d.IsDir() {
+			if archiveSkipDirs[baseName] || strings.HasPrefix(baseName, ".") || path == skipDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip hidden files and binary files
+		if strings.HasPrefix(baseName, ".") || archiveBinaryExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		e := &archiveEntry{path: path, rel: filepath.ToSlash(relPath), d: d}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// Symlinks are archived as the file they point to, if it is a
+			// regular file inside the workspace
+			info, ok := resolveWorkspaceLink(workspaceRoot, path)
+			if !ok {
+				return nil
+			}
+			e.info = info
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	// WalkDir sorts names per directory, which puts "a/b" before "a-b"
+	if walkErr == nil {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].rel < entries[j].rel })
+	dispatch:
+		for seq, e := range entries {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				walkErr = ctx.Err()
+				break dispatch
+			}
+			e.seq = seq
+			jobs <- e
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(done)
+	err = <-writeErr
+
+	if walkErr != nil {
+		return fmt.Errorf("walking workspace: %w", walkErr)
+	}
+	if err != nil {
+		return fmt.Errorf("writing archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("writing archive: %w", err)
+	}
+	if err := zipFile.Close(); err != nil {
+		return fmt.Errorf("writing archive: %w", err)
+	}
+
+	fmt.Printf("Archived %d files with %d workers\n", written, workers)
+	report.addMetric("files", int64(written))
+	return nil
+}
+
+// deflateEntry stats, reads and compresses a file. It returns a nil header
+// if the file should be left out: unreadable, or larger than maxFileSize.
+func deflateEntry(e *archiveEntry) (*zip.FileHeader, []byte) {
+	info := e.info
+	if info == nil {
+		var err error
+		if info, err = e.d.Info(); err != nil {
+			return nil, nil
+		}
+	}
+	if info.Size() > maxFileSize {
+		return nil, nil
+	}
+	header := &zip.FileHeader{Name: e.rel, Method: zip.Deflate, ModifiedDate: archiveModDate}
+	// CreateHeader would flag non-ASCII names as UTF-8, CreateRaw does not
+	if !isASCII(e.rel) && utf8.ValidString(e.rel) {
+		header.Flags |= 0x800
+	}
+	if info.Mode()&0111 != 0 {
+		header.SetMode(0755)
+	} else {
+		header.SetMode(0644)
+	}
+
+	file, err := os.Open(e.path)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	fw := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(fw)
+	fw.Reset(&buf)
+	crc := crc32.NewIEEE()
+	// The file may have grown since it was stat'ed; the size limit holds
+	// for what is read.
+	n, err := io.Copy(io.MultiWriter(fw, crc), io.LimitReader(file, maxFileSize+1))
+	if err != nil || n > maxFileSize {
+		return nil, nil
+	}
+	if err := fw.Close(); err != nil {
+		return nil, nil
+	}
+	header.CRC32 = crc.Sum32()
+	header.UncompressedSize64 = uint64(n)
+	header.CompressedSize64 = uint64(buf.Len())
+	return header, buf.Bytes()
+}
+
+// resolveWorkspaceLink stats the target of the symlink at path. It reports
+// false unless the target is a regular file inside root, so links can't pull
+// files from elsewhere on the runner into the archive.
+func resolveWorkspaceLink(root, path string) (fs.FileInfo, bool) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, false
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, false
+	}
+	info, err := os.Stat(target)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	return info, true
+}
+
+// isASCII reports whether s has only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// archiveDigest identifies the files of an archive as "sha256:<hex>". It
+// hashes a manifest of the entries rather than the archive itself, so it
+// doesn't change with the compressor: for each entry, sorted by name, a line
+// "<sha256 of the content> <octal mode> <name>\n".
+func archiveDigest(zipPath string) (string, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	files := append([]*zip.File(nil), zr.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	manifest := sha256.New()
+	for _, f := range files {
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		fmt.Fprintf(manifest, "%x %o %s\n", h.Sum(nil), f.Mode().Perm(), f.Name)
+	}
+	return "sha256:" + hex.EncodeToString(manifest.Sum(nil)), nil
+}
+
+// writeRawEntry adds a compressed entry to the archive.
+func writeRawEntry(zw *zip.Writer, e *archiveEntry) error {
+	w, err := zw.CreateRaw(e.header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(e.data)
+	return err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFiles creates files under dir from a map of slash paths to content.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTestZip returns the entries of an archive by name.
+func readTestZip(t *testing.T, path string) map[string]*zip.File {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { zr.Close() })
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	return files
+}
+
+func TestCreateRepoZipUTF8Names(t *testing.T) {
+	ws := t.TempDir()
+	writeTestFiles(t, ws, map[string]string{
+		"main.go":        "package main\n",
+		"docs/résumé.md": "# Résumé\n",
+		"src/日本語/mod.go": "package mod\n",
+	})
+	zipPath := filepath.Join(t.TempDir(), "repo.zip")
+	if err := createRepoZip(context.Background(), ws, zipPath, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readTestZip(t, zipPath)
+	for name, utf8 := range map[string]bool{
+		"main.go":        false,
+		"docs/résumé.md": true,
+		"src/日本語/mod.go": true,
+	} {
+		f := files[name]
+		if f == nil {
+			t.Errorf("%s missing from archive", name)
+			continue
+		}
+		if got := f.Flags&0x800 != 0; got != utf8 {
+			t.Errorf("%s: UTF-8 flag = %v, want %v", name, got, utf8)
+		}
+		if utf8 && f.NonUTF8 {
+			t.Errorf("%s: reader treats name as non-UTF-8", name)
+		}
+	}
+}
+
+func TestCreateRepoZipSymlinks(t *testing.T) {
+	ws := t.TempDir()
+	outside := t.TempDir()
+	writeTestFiles(t, ws, map[string]string{"lib/real.go": "package lib\n"})
+	writeTestFiles(t, outside, map[string]string{"secret.txt": "token\n"})
+	for link, target := range map[string]string{
+		"lib/alias.go":   "real.go",
+		"lib/outside.go": filepath.Join(outside, "secret.txt"),
+		"lib/dir.go":     ".",
+		"lib/dangling":   "missing.go",
+	} {
+		if err := os.Symlink(target, filepath.Join(ws, filepath.FromSlash(link))); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+	zipPath := filepath.Join(t.TempDir(), "repo.zip")
+	if err := createRepoZip(context.Background(), ws, zipPath, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readTestZip(t, zipPath)
+	if len(files) != 2 {
+		names := []string{}
+		for name := range files {
+			names = append(names, name)
+		}
+		t.Fatalf("archived %v, want lib/real.go and lib/alias.go", names)
+	}
+	f := files["lib/alias.go"]
+	if f == nil {
+		t.Fatal("symlink to a workspace file was not archived")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "package lib\n" {
+		t.Errorf("lib/alias.go = %q, want the target's content", data)
+	}
+}
+
+func TestArchiveDigestIgnoresCompression(t *testing.T) {
+	files := map[string]string{"b/main.go": "package main\n", "a.go": "package a\n", "run.sh": "#!/bin/sh\n"}
+	ws := t.TempDir()
+	writeTestFiles(t, ws, files)
+	if err := os.Chmod(filepath.Join(ws, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	canonical := filepath.Join(t.TempDir(), "repo.zip")
+	if err := createRepoZip(context.Background(), ws, canonical, ""); err != nil {
+		t.Fatal(err)
+	}
+	want, err := archiveDigest(canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same files stored uncompressed, in another order, with other dates
+	writeZip := func(mode os.FileMode) string {
+		path := filepath.Join(t.TempDir(), "other.zip")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for _, name := range []string{"run.sh", "b/main.go", "a.go"} {
+			h := &zip.FileHeader{Name: name, Method: zip.Store}
+			h.SetMode(0644)
+			if name == "run.sh" {
+				h.SetMode(mode)
+			}
+			w, err := zw.CreateHeader(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, files[name])
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	if got, err := archiveDigest(writeZip(0755)); err != nil || got != want {
+		t.Errorf("digest of stored archive = %s, %v, want %s", got, err, want)
+	}
+	if got, _ := archiveDigest(writeZip(0644)); got == want {
+		t.Error("digest ignores file modes")
+	}
+}
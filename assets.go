@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Asset modes for the assets input.
+const (
+	assetsCDN      = "cdn"
+	assetsSelfHost = "self-host"
+)
+
+// vendorSiteDir is where self-hosted assets are written in the site.
+const vendorSiteDir = "vendor"
+
+// vendorFS holds the pinned third-party assets downloaded by
+// scripts/vendor-assets.sh. Builds that skipped the script only contain
+// .gitkeep and can't self-host.
+//
+//go:embed all:assets/vendor
+var vendorFS embed.FS
+
+//go:embed assets/vendor.txt
+var vendorManifest string
+
+//go:embed assets/fonts.css
+var vendorFontsCSS []byte
+
+// googleFontsPattern matches <link> tags pointing at Google Fonts, including
+// preconnect hints, with their trailing newline.
+var googleFontsPattern = regexp.MustCompile(`<link[^>]*href="https://fonts\.(?:googleapis|gstatic)\.com[^"]*"[^>]*>\n?`)
+
+// externalAssetPattern finds references to CDNs left after rewriting.
+var externalAssetPattern = regexp.MustCompile(`https://(?:cdn\.jsdelivr\.net|unpkg\.com|cdnjs\.cloudflare\.com|fonts\.googleapis\.com|fonts\.gstatic\.com)/[^"'\s)]*`)
+
+// VendorAsset is a pinned third-party file.
+type VendorAsset struct {
+	Name   string
+	SHA256 string // hex, checked by scripts/vendor-assets.sh and at startup
+	URL    string
+}
+
+// parseAssetsMode validates the assets input.
+func parseAssetsMode(s string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(s)); m {
+	case "", assetsCDN:
+		return assetsCDN, nil
+	case assetsSelfHost, "self-hosted":
+		return assetsSelfHost, nil
+	default:
+		return "", fmt.Errorf("invalid assets %q: use cdn or self-host", s)
+	}
+}
+
+// vendorAssets parses assets/vendor.txt.
+func vendorAssets() []VendorAsset {
+	return parseVendorManifest(vendorManifest)
+}
+
+// parseVendorManifest parses "<file> <sha256> <url>" lines, skipping blank
+// lines and comments.
+func parseVendorManifest(manifest string) []VendorAsset {
+	var assets []VendorAsset
+	scanner := bufio.NewScanner(strings.NewReader(manifest))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if f := strings.Fields(line); len(f) == 3 {
+			assets = append(assets, VendorAsset{Name: f[0], SHA256: strings.ToLower(f[1]), URL: f[2]})
+		}
+	}
+	return assets
+}
+
+// selfHostTemplates rewrites the staged templates to load the pinned assets
+// from /vendor/ instead of their CDN URLs, and replaces Google Fonts links
+// with the bundled fonts.css. It returns CDN references it could not
+// rewrite, such as assets custom templates added.
+func selfHostTemplates(tplDir string) ([]string, error) {
+	assets := vendorAssets()
+	var leftover []string
+	err := filepath.Walk(tplDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		content := string(data)
+		for _, a := range assets {
+			content = strings.ReplaceAll(content, a.URL, "/"+vendorSiteDir+"/"+a.Name)
+		}
+		first := true
+		content = googleFontsPattern.ReplaceAllStringFunc(content, func(tag string) string {
+			if strings.Contains(tag, "preconnect") || !first {
+				return ""
+			}
+			first = false
+			return `<link href="/` + vendorSiteDir + `/fonts.css" rel="stylesheet">` + "\n"
+		})
+		for _, ref := range externalAssetPattern.FindAllString(content, -1) {
+			rel, _ := filepath.Rel(tplDir, path)
+			leftover = append(leftover, rel+": "+ref)
+		}
+		if content != string(data) {
+			return os.WriteFile(path, []byte(content), info.Mode())
+		}
+		return nil
+	})
+	return leftover, err
+}
+
+// missingVendorAssets returns the pinned assets this binary was built
+// without, or with content that doesn't match the pinned checksum. An
+// entry whose checksum was never pinned is reported as such.
+func missingVendorAssets() []string {
+	var missing []string
+	for _, a := range vendorAssets() {
+		if !isSHA256Hex(a.SHA256) {
+			missing = append(missing, a.Name+" (no checksum pinned)")
+			continue
+		}
+		data, err := vendorFS.ReadFile("assets/vendor/" + a.Name)
+		if err != nil {
+			missing = append(missing, a.Name)
+			continue
+		}
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != a.SHA256 {
+			missing = append(missing, a.Name+" (checksum mismatch)")
+		}
+	}
+	return missing
+}
+
+// isSHA256Hex reports whether s is a lowercase hex SHA-256 digest.
+func isSHA256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// writeVendorAssets writes the embedded assets and fonts.css into
+// outputDir/vendor. It fails if the binary was built without them.
+func writeVendorAssets(outputDir string) error {
+	dir := filepath.Join(outputDir, vendorSiteDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, a := range vendorAssets() {
+		data, err := vendorFS.ReadFile("assets/vendor/" + a.Name)
+		if err != nil {
+			return fmt.Errorf("%s is not embedded in this build; run scripts/vendor-assets.sh before go build", a.Name)
+		}
+		if err := os.WriteFile(filepath.Join(dir, a.Name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, "fonts.css"), vendorFontsCSS, 0644)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVendorManifest(t *testing.T) {
+	got := parseVendorManifest(`# <file> <sha256> <url>
+
+d3.min.js 5891B5B522D5DF086D0FF0B110FBD9D21BB4FC7163AF34D08286A2E846F6BE03 https://cdn.example.com/d3.min.js
+  font.woff2   e258d248fda94c63753607f7c4494ee0fcbe92f1a76bfdac795c9d84101eb317   https://cdn.example.com/font.woff2
+old.js https://cdn.example.com/old.js
+`)
+	want := []VendorAsset{
+		{"d3.min.js", "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", "https://cdn.example.com/d3.min.js"},
+		{"font.woff2", "e258d248fda94c63753607f7c4494ee0fcbe92f1a76bfdac795c9d84101eb317", "https://cdn.example.com/font.woff2"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parsed %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// Every entry of assets/vendor.txt must be in the current format, or it
+// would be silently dropped.
+func TestVendorManifestEntries(t *testing.T) {
+	lines := 0
+	for _, line := range strings.Split(vendorManifest, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines++
+		}
+	}
+	if n := len(vendorAssets()); n != lines {
+		t.Errorf("assets/vendor.txt has %d entries, %d parse as <file> <sha256> <url>", lines, n)
+	}
+}
+
+func TestIsSHA256Hex(t *testing.T) {
+	tests := []struct {
+		sum  string
+		want bool
+	}{
+		{"5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", true},
+		{"-", false},
+		{"", false},
+		{"5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be0", false},
+		{"5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be0z", false},
+		{"5891B5B522D5DF086D0FF0B110FBD9D21BB4FC7163AF34D08286A2E846F6BE03", false},
+	}
+	for _, tt := range tests {
+		if got := isSHA256Hex(tt.sum); got != tt.want {
+			t.Errorf("isSHA256Hex(%q) = %v, want %v", tt.sum, got, tt.want)
+		}
+	}
+}
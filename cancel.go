@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// exitCancelled is the exit code of a run stopped by SIGINT or SIGTERM, so
+// callers can tell a cancellation from a failure (exit code 1).
+const exitCancelled = 130
+
+// commandStopGrace is how long graph2md and pssg get to exit after SIGTERM
+// before they are killed. Docker kills the action 10 seconds after its own
+// SIGTERM, so this leaves time to clean up.
+const commandStopGrace = 5 * time.Second
+
+// runCtx is cancelled when the run receives SIGINT or SIGTERM.
+var runCtx = context.Background()
+
+// cleanups are run before the process exits, most recent first. fatal calls
+// os.Exit, which skips deferred calls, so temporary files are removed here.
+var (
+	cleanupMu sync.Mutex
+	cleanups  []func()
+)
+
+// cancelOnSignal returns a context that is cancelled on the first SIGINT or
+// SIGTERM. A second signal terminates the process immediately.
+func cancelOnSignal() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		signal.Stop(sigs)
+		fmt.Printf("::warning::Received %s, cancelling\n", sig)
+		cancel()
+	}()
+	return ctx
+}
+
+// atExit registers f to run before the process exits.
+func atExit(f func()) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	cleanups = append(cleanups, f)
+}
+
+// runCleanups runs the registered cleanups once, most recent first.
+func runCleanups() {
+	cleanupMu.Lock()
+	fs := cleanups
+	cleanups = nil
+	cleanupMu.Unlock()
+	for i := len(fs) - 1; i >= 0; i-- {
+		fs[i]()
+	}
+}
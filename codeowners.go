@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// unownedLabel is the owners value given to files no CODEOWNERS rule covers,
+// so the owner taxonomy doubles as the unowned-files report.
+const unownedLabel = "Unowned"
+
+// codeownersLocations are the paths GitHub checks for a CODEOWNERS file, in
+// the order it checks them. Only the first file found is used.
+var codeownersLocations = []string{
+	".github/CODEOWNERS",
+	"CODEOWNERS",
+	"docs/CODEOWNERS",
+}
+
+// ownersTaxonomy groups entities by their CODEOWNERS owners.
+var ownersTaxonomy = TaxonomyConfig{
+	Name:             "owners",
+	Label:            "Owners",
+	LabelSingular:    "Owner",
+	Field:            "owners",
+	MultiValue:       true,
+	MinEntities:      1,
+	IndexDescription: "Browse by code owner",
+}
+
+// CodeOwners is a parsed CODEOWNERS file.
+type CodeOwners struct {
+	Path  string
+	Rules []OwnerRule
+}
+
+// OwnerRule is a single CODEOWNERS line. A rule with no owners explicitly
+// marks matching files as unowned.
+type OwnerRule struct {
+	Pattern string
+	Owners  []string
+	re      *regexp.Regexp
+}
+
+// OwnerStats summarizes what a single owner (or unownedLabel) owns.
+type OwnerStats struct {
+	Owner    string         `json:"owner"`
+	Files    []string       `json:"files"`
+	Entities int            `json:"entities"`
+	ByType   map[string]int `json:"by_type"`
+}
+
+// findCodeOwners locates and parses the workspace CODEOWNERS file. It returns
+// nil if the repository has none.
+func findCodeOwners(workspaceDir string) (*CodeOwners, error) {
+	for _, loc := range codeownersLocations {
+		path := filepath.Join(workspaceDir, loc)
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		co, err := parseCodeOwners(f)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", loc, err)
+		}
+		co.Path = loc
+		return co, nil
+	}
+	return nil, nil
+}
+
+// parseCodeOwners reads CODEOWNERS rules from r.
+func parseCodeOwners(r io.Reader) (*CodeOwners, error) {
+	co := &CodeOwners{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		pattern := strings.ReplaceAll(fields[0], `\#`, "#")
+		re, err := codeownersPatternRegexp(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		co.Rules = append(co.Rules, OwnerRule{Pattern: pattern, Owners: fields[1:], re: re})
+	}
+	return co, scanner.Err()
+}
+
+// codeownersPatternRegexp compiles a gitignore-style CODEOWNERS pattern.
+// Patterns containing a non-trailing slash are anchored at the repository
+// root; others match at any depth. A pattern that matches a directory also
+// matches everything beneath it, a trailing slash only matches directories,
+// and a trailing "/*" only matches direct children.
+func codeownersPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	p := strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern)
+	}
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				i++
+				if i+1 < len(p) && p[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	switch {
+	case dirOnly:
+		b.WriteString("/.*$")
+	case strings.HasSuffix(p, "/*") && !strings.HasSuffix(p, "/**"):
+		b.WriteString("$")
+	default:
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
+
+// OwnersOf returns the owners of a repository-relative file path using
+// GitHub's last-match-wins semantics. It returns nil for unowned files.
+func (co *CodeOwners) OwnersOf(relPath string) []string {
+	relPath = strings.TrimPrefix(filepath.ToSlash(relPath), "/")
+	for i := len(co.Rules) - 1; i >= 0; i-- {
+		if co.Rules[i].re.MatchString(relPath) {
+			return co.Rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// attachOwners adds an owners field to every file-backed entity and returns
+// per-owner statistics, sorted by owner with unownedLabel last.
+func attachOwners(entities []*Entity, co *CodeOwners) ([]*OwnerStats, error) {
+	stats := map[string]*OwnerStats{}
+	files := map[string]map[string]bool{}
+	for _, e := range entities {
+		filePath := e.GetString("file_path")
+		if filePath == "" {
+			continue
+		}
+		owners := co.OwnersOf(filePath)
+		if len(owners) == 0 {
+			owners = []string{unownedLabel}
+		}
+		if err := setFrontmatterFields(e, map[string]interface{}{
+			"owners":      owners,
+			"owners_text": strings.Join(owners, ", "),
+		}); err != nil {
+			return nil, err
+		}
+		for _, o := range owners {
+			s := stats[o]
+			if s == nil {
+				s = &OwnerStats{Owner: o, ByType: map[string]int{}}
+				stats[o] = s
+				files[o] = map[string]bool{}
+			}
+			s.Entities++
+			s.ByType[e.GetString("node_type")]++
+			if !files[o][filePath] {
+				files[o][filePath] = true
+				s.Files = append(s.Files, filePath)
+			}
+		}
+	}
+
+	out := make([]*OwnerStats, 0, len(stats))
+	for _, s := range stats {
+		sort.Strings(s.Files)
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].Owner == unownedLabel) != (out[j].Owner == unownedLabel) {
+			return out[j].Owner == unownedLabel
+		}
+		return out[i].Owner < out[j].Owner
+	})
+	return out, nil
+}
+
+// writeOwnershipReport writes ownership.json with per-owner statistics,
+// including the list of unowned files.
+func writeOwnershipReport(path, source string, stats []*OwnerStats) error {
+	report := struct {
+		Source string        `json:"source"`
+		Owners []*OwnerStats `json:"owners"`
+	}{source, stats}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodeownersPatternRegexp(t *testing.T) {
+	// Patterns from GitHub's CODEOWNERS documentation, plus edge cases.
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{"*", []string{"README.md", "src/app/main.go"}, nil},
+		{"*.js", []string{"app.js", "src/deep/app.js"}, []string{"app.jsx", "app.js.map"}},
+		// Unanchored: a file or directory of the name at any depth
+		{"docs", []string{"docs", "docs/a.md", "src/docs/a.md"}, []string{"docsite/a.md", "src/mydocs/a.md"}},
+		// A trailing slash only matches directories, at any depth
+		{"apps/", []string{"apps/a.go", "src/apps/b/c.go"}, []string{"apps", "myapps/a.go"}},
+		// A leading or inner slash anchors at the root
+		{"/docs/", []string{"docs/a.md", "docs/sub/b.md"}, []string{"src/docs/a.md"}},
+		{"/build/logs/", []string{"build/logs/a.log", "build/logs/x/b.log"}, []string{"src/build/logs/a.log", "build/log.txt"}},
+		{"src/main.go", []string{"src/main.go"}, []string{"lib/src/main.go", "src/main.go.orig"}},
+		// A trailing /* only matches direct children
+		{"docs/*", []string{"docs/getting-started.md"}, []string{"docs/build-app/troubleshooting.md", "src/docs/a.md"}},
+		// * stays within a segment, ** crosses them
+		{"src/*/test.go", []string{"src/a/test.go"}, []string{"src/test.go", "src/a/b/test.go"}},
+		{"src/**/test.go", []string{"src/test.go", "src/a/test.go", "src/a/b/test.go"}, []string{"lib/src/a/test.go"}},
+		{"**/logs", []string{"logs/a.log", "build/logs/a.log", "deeply/nested/logs/a.log"}, []string{"build/logsdir/a.log"}},
+		{"lib/**", []string{"lib/a.go", "lib/x/y.go"}, []string{"src/lib/a.go"}},
+		{"?.go", []string{"a.go", "pkg/b.go"}, []string{"ab.go", "a/.go"}},
+		// Regexp metacharacters are literal
+		{"file(1).txt", []string{"file(1).txt", "a/file(1).txt"}, []string{"file1.txt"}},
+		{"a+b.go", []string{"a+b.go"}, []string{"aab.go"}},
+		{"#notes.md", []string{"#notes.md", "a/#notes.md"}, []string{"notes.md"}},
+	}
+	for _, tt := range tests {
+		re, err := codeownersPatternRegexp(tt.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", tt.pattern, err)
+			continue
+		}
+		for _, p := range tt.match {
+			if !re.MatchString(p) {
+				t.Errorf("%q does not match %s", tt.pattern, p)
+			}
+		}
+		for _, p := range tt.noMatch {
+			if re.MatchString(p) {
+				t.Errorf("%q matches %s", tt.pattern, p)
+			}
+		}
+	}
+
+	for _, pattern := range []string{"/", ""} {
+		if _, err := codeownersPatternRegexp(pattern); err == nil {
+			t.Errorf("%q compiled, want an error", pattern)
+		}
+	}
+}
+
+func TestOwnersOf(t *testing.T) {
+	co, err := parseCodeOwners(strings.NewReader(`# Default owners
+*       @global-owner1 @global-owner2
+
+*.js    @js-owner # JavaScript
+*.go    docs@example.com
+/build/logs/ @doctocat
+docs/*  docs@example.com
+apps/   @octocat
+/apps/github
+\#notes.md @notes-owner
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"README.md", "@global-owner1 @global-owner2"},
+		{"src/app.js", "@js-owner"},
+		{"/src/app.js", "@js-owner"},
+		{"main.go", "docs@example.com"},
+		// Later rules win over earlier ones
+		{"build/logs/app.js", "@doctocat"},
+		{"docs/intro.md", "docs@example.com"},
+		{"docs/guides/intro.md", "@global-owner1 @global-owner2"},
+		{"apps/web/app.js", "@octocat"},
+		{"lib/apps/x.go", "@octocat"},
+		// A rule without owners leaves matching files unowned
+		{"apps/github/app.js", ""},
+		{"#notes.md", "@notes-owner"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(co.OwnersOf(tt.path), " "); got != tt.want {
+			t.Errorf("OwnersOf(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	// Comment-only lines and inline comments are dropped
+	if n := len(co.Rules); n != 8 {
+		t.Errorf("parsed %d rules, want 8", n)
+	}
+}
+
+func TestAttachOwners(t *testing.T) {
+	co, err := parseCodeOwners(strings.NewReader("/src/ @core\n/src/api/ @api @core\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, fm := range map[string]string{
+		"a.md": "file_path: src/main.go\nnode_type: File\n",
+		"b.md": "file_path: src/api/handler.go\nnode_type: Function\n",
+		"c.md": "file_path: scripts/build.sh\nnode_type: File\n",
+		"d.md": "node_type: Domain\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("---\n"+fm+"---\nbody\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entities, err := loadEntities(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := attachOwners(entities, co)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range stats {
+		got = append(got, s.Owner+"="+strings.Join(s.Files, ","))
+	}
+	want := "@api=src/api/handler.go @core=src/api/handler.go,src/main.go Unowned=scripts/build.sh"
+	if strings.Join(got, " ") != want {
+		t.Errorf("stats = %v, want %s", got, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "c.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `owners: ["Unowned"]`) || !strings.Contains(string(data), "owners_text: \"Unowned\"") {
+		t.Errorf("unowned file frontmatter:\n%s", data)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "d.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "owners") {
+		t.Errorf("entity without a file was given owners:\n%s", data)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PSSGConfig is the pssg.yaml document. Field order matches the order keys
+// are written in, so the generated file stays readable.
+type PSSGConfig struct {
+	Site           SiteConfig           `yaml:"site"`
+	Paths          PathsConfig          `yaml:"paths"`
+	Data           DataConfig           `yaml:"data"`
+	Taxonomies     []TaxonomyConfig     `yaml:"taxonomies"`
+	Pagination     PaginationConfig     `yaml:"pagination"`
+	StructuredData StructuredDataConfig `yaml:"structured_data"`
+	Sitemap        SitemapConfig        `yaml:"sitemap"`
+	RSS            FeedConfig           `yaml:"rss"`
+	Robots         ToggleConfig         `yaml:"robots"`
+	LLMsTxt        FeedConfig           `yaml:"llms_txt"`
+	Search         ToggleConfig         `yaml:"search"`
+	Templates      TemplatesConfig      `yaml:"templates"`
+	Output         OutputConfig         `yaml:"output"`
+	Extra          ExtraConfig          `yaml:"extra"`
+}
+
+// SiteConfig describes the site metadata.
+type SiteConfig struct {
+	Name        string `yaml:"name"`
+	BaseURL     string `yaml:"base_url"`
+	RepoURL     string `yaml:"repo_url"`
+	Description string `yaml:"description"`
+	Author      string `yaml:"author"`
+	Language    string `yaml:"language"`
+}
+
+// PathsConfig holds the input and output locations pssg reads and writes.
+type PathsConfig struct {
+	Data      string `yaml:"data"`
+	Templates string `yaml:"templates"`
+	Output    string `yaml:"output"`
+	SourceDir string `yaml:"source_dir"`
+}
+
+// DataConfig describes how entity markdown is parsed.
+type DataConfig struct {
+	Format       string          `yaml:"format"`
+	EntityType   string          `yaml:"entity_type"`
+	EntitySlug   EntitySlug      `yaml:"entity_slug"`
+	BodySections []SectionConfig `yaml:"body_sections"`
+}
+
+// EntitySlug selects where entity slugs come from.
+type EntitySlug struct {
+	Source string `yaml:"source"`
+}
+
+// SectionConfig maps a markdown body section to a named entity section.
+type SectionConfig struct {
+	Name   string `yaml:"name"`
+	Header string `yaml:"header"`
+	Type   string `yaml:"type"`
+}
+
+// TaxonomyConfig defines a taxonomy built from a frontmatter field.
+type TaxonomyConfig struct {
+	Name             string `yaml:"name"`
+	Label            string `yaml:"label"`
+	LabelSingular    string `yaml:"label_singular"`
+	Field            string `yaml:"field"`
+	MultiValue       bool   `yaml:"multi_value"`
+	MinEntities      int    `yaml:"min_entities"`
+	IndexDescription string `yaml:"index_description"`
+}
+
+// PaginationConfig controls hub page pagination.
+type PaginationConfig struct {
+	PerPage    int    `yaml:"per_page"`
+	URLPattern string `yaml:"url_pattern"`
+}
+
+// StructuredDataConfig maps entity fields to JSON-LD properties.
+type StructuredDataConfig struct {
+	EntityType    string            `yaml:"entity_type"`
+	FieldMappings map[string]string `yaml:"field_mappings"`
+}
+
+// SitemapConfig controls sitemap generation.
+type SitemapConfig struct {
+	Enabled        bool               `yaml:"enabled"`
+	MaxURLsPerFile int                `yaml:"max_urls_per_file"`
+	Priorities     map[string]float64 `yaml:"priorities"`
+}
+
+// FeedConfig configures a generated feed such as RSS or llms.txt.
+type FeedConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+}
+
+// ToggleConfig is a feature that can only be switched on or off.
+type ToggleConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// TemplatesConfig names the page templates.
+type TemplatesConfig struct {
+	Entity        string `yaml:"entity"`
+	Homepage      string `yaml:"homepage"`
+	Hub           string `yaml:"hub"`
+	TaxonomyIndex string `yaml:"taxonomy_index"`
+	AllEntities   string `yaml:"all_entities"`
+}
+
+// OutputConfig controls how the output directory is written.
+type OutputConfig struct {
+	CleanBeforeBuild bool   `yaml:"clean_before_build"`
+	ExtractCSS       string `yaml:"extract_css"`
+	ExtractJS        string `yaml:"extract_js"`
+}
+
+// ExtraConfig holds values passed through to templates.
+type ExtraConfig struct {
+	CTA   CTAConfig   `yaml:"cta"`
+	Theme ThemeConfig `yaml:"theme,omitempty"`
+}
+
+// CTAConfig is the call-to-action block shown on pages.
+type CTAConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Heading     string `yaml:"heading"`
+	Description string `yaml:"description"`
+	ButtonText  string `yaml:"button_text"`
+	ButtonURL   string `yaml:"button_url"`
+}
+
+// ThemeConfig restyles the bundled templates. Empty fields keep the
+// defaults; the logo and favicon are relative to the workspace.
+type ThemeConfig struct {
+	Mode     string `yaml:"mode,omitempty"`      // dark (default), light or auto
+	Primary  string `yaml:"primary,omitempty"`   // buttons, highlights and chart accents
+	Accent   string `yaml:"accent,omitempty"`    // links and hover states
+	Font     string `yaml:"font,omitempty"`      // CSS font stack for text
+	MonoFont string `yaml:"mono_font,omitempty"` // CSS font stack for code
+	Logo     string `yaml:"logo,omitempty"`
+	Favicon  string `yaml:"favicon,omitempty"`
+}
+
+// defaultBodySections are the markdown sections graph2md emits, in the
+// order they appear on entity pages.
+var defaultBodySections = []SectionConfig{
+	{Name: "Domain", Header: "Domain", Type: "unordered_list"},
+	{Name: "Subdomains", Header: "Subdomains", Type: "unordered_list"},
+	{Name: "Defined In", Header: "Defined In", Type: "unordered_list"},
+	{Name: "Functions", Header: "Functions", Type: "unordered_list"},
+	{Name: "Classes", Header: "Classes", Type: "unordered_list"},
+	{Name: "Types", Header: "Types", Type: "unordered_list"},
+	{Name: "Dependencies", Header: "Dependencies", Type: "unordered_list"},
+	{Name: "Imported By", Header: "Imported By", Type: "unordered_list"},
+	{Name: "Calls", Header: "Calls", Type: "unordered_list"},
+	{Name: "Called By", Header: "Called By", Type: "unordered_list"},
+	{Name: "Source Files", Header: "Source Files", Type: "unordered_list"},
+	{Name: "Subdirectories", Header: "Subdirectories", Type: "unordered_list"},
+	{Name: "Files", Header: "Files", Type: "unordered_list"},
+	{Name: "Extends", Header: "Extends", Type: "unordered_list"},
+	{Name: "Source", Header: "Source", Type: "unordered_list"},
+	{Name: "faqs", Header: "FAQs", Type: "faq"},
+}
+
+// defaultTaxonomies are the taxonomies built from graph2md frontmatter.
+var defaultTaxonomies = []TaxonomyConfig{
+	{Name: "node_type", Label: "Node Types", LabelSingular: "Node Type", Field: "node_type", MinEntities: 1, IndexDescription: "Browse by entity type"},
+	{Name: "language", Label: "Languages", LabelSingular: "Language", Field: "language", MinEntities: 1, IndexDescription: "Browse by programming language"},
+	{Name: "domain", Label: "Domains", LabelSingular: "Domain", Field: "domain", MinEntities: 1, IndexDescription: "Browse by architectural domain"},
+	{Name: "subdomain", Label: "Subdomains", LabelSingular: "Subdomain", Field: "subdomain", MinEntities: 1, IndexDescription: "Browse by architectural subdomain"},
+	{Name: "top_directory", Label: "Top Directories", LabelSingular: "Directory", Field: "top_directory", MinEntities: 1, IndexDescription: "Browse by top-level directory"},
+	{Name: "extension", Label: "File Extensions", LabelSingular: "Extension", Field: "extension", MinEntities: 1, IndexDescription: "Browse by file extension"},
+	{Name: "tags", Label: "Tags", LabelSingular: "Tag", Field: "tags", MultiValue: true, MinEntities: 1, IndexDescription: "Browse by tag"},
+}
+
+// newPSSGConfig returns the default pssg configuration for a site.
+func newPSSGConfig(siteName, baseURL, repoURL, repoName, contentDir, tplDir, outputDir, sourceDir string) *PSSGConfig {
+	return &PSSGConfig{
+		Site: SiteConfig{
+			Name:        siteName,
+			BaseURL:     baseURL,
+			RepoURL:     repoURL,
+			Description: fmt.Sprintf("Architecture documentation for the %s codebase. Explore files, functions, classes, domains, and dependencies.", repoName),
+			Author:      "Supermodel",
+			Language:    "en",
+		},
+		Paths: PathsConfig{
+			Data:      contentDir,
+			Templates: tplDir,
+			Output:    outputDir,
+			SourceDir: sourceDir,
+		},
+		Data: DataConfig{
+			Format:       "markdown",
+			EntityType:   "entity",
+			EntitySlug:   EntitySlug{Source: "filename"},
+			BodySections: append([]SectionConfig(nil), defaultBodySections...),
+		},
+		Taxonomies: append([]TaxonomyConfig(nil), defaultTaxonomies...),
+		Pagination: PaginationConfig{
+			PerPage:    48,
+			URLPattern: "/{taxonomy}/{entry}/{page}",
+		},
+		StructuredData: StructuredDataConfig{
+			EntityType: "SoftwareSourceCode",
+			FieldMappings: map[string]string{
+				"name":                "title",
+				"description":         "description",
+				"programmingLanguage": "language",
+				"codeRepository":      "repo_url",
+			},
+		},
+		Sitemap: SitemapConfig{
+			Enabled:        true,
+			MaxURLsPerFile: 50000,
+			Priorities: map[string]float64{
+				"homepage":       1.0,
+				"entity":         0.8,
+				"taxonomy_index": 0.7,
+				"hub_page_1":     0.6,
+				"hub_page_n":     0.4,
+			},
+		},
+		RSS: FeedConfig{
+			Enabled:     true,
+			Title:       siteName,
+			Description: fmt.Sprintf("Architecture documentation for the %s codebase", repoName),
+		},
+		Robots: ToggleConfig{Enabled: true},
+		LLMsTxt: FeedConfig{
+			Enabled:     true,
+			Title:       siteName,
+			Description: fmt.Sprintf("Architecture documentation for the %s codebase", repoName),
+		},
+		Search: ToggleConfig{Enabled: true},
+		Templates: TemplatesConfig{
+			Entity:        "entity.html",
+			Homepage:      "index.html",
+			Hub:           "hub.html",
+			TaxonomyIndex: "taxonomy_index.html",
+			AllEntities:   "all_entities.html",
+		},
+		Output: OutputConfig{
+			CleanBeforeBuild: true,
+			ExtractCSS:       "styles.css",
+			ExtractJS:        "main.js",
+		},
+		Extra: ExtraConfig{
+			CTA: CTAConfig{
+				Enabled:     true,
+				Heading:     "Analyze Your Own Codebase",
+				Description: "Get architecture documentation, dependency graphs, and domain analysis for your codebase in minutes.",
+				ButtonText:  "Try Supermodel Free",
+				ButtonURL:   "https://dashboard.supermodeltools.com/billing/",
+			},
+		},
+	}
+}
+
+// privateRobotsTxt replaces pssg's robots.txt in private mode.
+const privateRobotsTxt = "User-agent: *\nDisallow: /\n"
+
+// applyPrivateMode turns off everything aimed at search engines and public
+// promotion: the CTA, the author, the sitemap, RSS, llms.txt and pssg's
+// robots.txt, which arch-docs replaces with a disallow-all one. The overlay
+// can still set its own CTA and author.
+func applyPrivateMode(cfg *PSSGConfig) {
+	cfg.Site.Author = ""
+	cfg.Extra.CTA = CTAConfig{}
+	cfg.Sitemap.Enabled = false
+	cfg.RSS.Enabled = false
+	cfg.LLMsTxt.Enabled = false
+	cfg.Robots.Enabled = false
+}
+
+// renderConfig serializes cfg to YAML and deep-merges the optional overlay
+// file on top of it. Mappings are merged key by key, any other value in the
+// overlay replaces the generated one, and a key set to null is removed.
+// overrides are merged last, in the same way, for settings arch-docs must
+// control regardless of the overlay.
+func renderConfig(cfg *PSSGConfig, overlayPath string, overrides ...map[string]interface{}) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(cfg); err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+
+	if overlayPath != "" {
+		data, err := os.ReadFile(overlayPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading config overlay: %w", err)
+		}
+		var overlay yaml.Node
+		if err := yaml.Unmarshal(data, &overlay); err != nil {
+			return nil, fmt.Errorf("parsing config overlay %s: %w", overlayPath, err)
+		}
+		if len(overlay.Content) > 0 {
+			root := overlay.Content[0]
+			if root.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("config overlay %s must be a YAML mapping", overlayPath)
+			}
+			mergeYAML(&doc, root)
+		}
+	}
+
+	for _, o := range overrides {
+		var node yaml.Node
+		if err := node.Encode(o); err != nil {
+			return nil, fmt.Errorf("encoding config override: %w", err)
+		}
+		mergeYAML(&doc, &node)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("writing config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("writing config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeYAML deep-merges the mapping src into the mapping dst in place.
+func mergeYAML(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, val := src.Content[i], src.Content[i+1]
+		idx := mappingIndex(dst, key.Value)
+
+		if val.Tag == "!!null" {
+			if idx >= 0 {
+				dst.Content = append(dst.Content[:idx], dst.Content[idx+2:]...)
+			}
+			continue
+		}
+		if idx < 0 {
+			dst.Content = append(dst.Content, key, val)
+			continue
+		}
+		cur := dst.Content[idx+1]
+		if cur.Kind == yaml.MappingNode && val.Kind == yaml.MappingNode {
+			mergeYAML(cur, val)
+		} else {
+			dst.Content[idx+1] = val
+		}
+	}
+}
+
+// mappingIndex returns the index of key in a mapping node's content, or -1.
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
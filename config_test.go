@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeYAML(t *testing.T) {
+	tests := []struct {
+		name, dst, src, want string
+	}{
+		{
+			"nested mappings merge key by key",
+			"site:\n  name: A\n  extra:\n    x: 1\n    y: 2\n",
+			"site:\n  extra:\n    y: 3\n    z: 4\n",
+			"site:\n  name: A\n  extra:\n    x: 1\n    y: 3\n    z: 4\n",
+		},
+		{
+			"lists are replaced, not appended",
+			"taxonomies:\n  - name: a\n  - name: b\n",
+			"taxonomies:\n  - name: c\n",
+			"taxonomies:\n  - name: c\n",
+		},
+		{
+			"null removes a key",
+			"rss:\n  enabled: true\nsite:\n  name: A\n  author: B\n",
+			"rss: null\nsite:\n  author: ~\n",
+			"site:\n  name: A\n",
+		},
+		{
+			"null for a missing key is ignored",
+			"site:\n  name: A\n",
+			"robots: null\n",
+			"site:\n  name: A\n",
+		},
+		{
+			"new keys are added",
+			"site:\n  name: A\n",
+			"site:\n  description: D\nsearch:\n  enabled: true\n",
+			"site:\n  name: A\n  description: D\nsearch:\n  enabled: true\n",
+		},
+		{
+			"a scalar replaces a mapping and the other way round",
+			"a:\n  x: 1\nb: 2\n",
+			"a: 1\nb:\n  y: 2\n",
+			"a: 1\nb:\n  y: 2\n",
+		},
+	}
+	parse := func(s string) *yaml.Node {
+		t.Helper()
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(s), &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc.Content[0]
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := parse(tt.dst)
+			mergeYAML(dst, parse(tt.src))
+			var got, want interface{}
+			if err := dst.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				out, _ := yaml.Marshal(dst)
+				t.Errorf("merged:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	tmp := t.TempDir()
+	siteName := `Acme "Core": API # v2`
+	baseURL := "https://example.com/docs?a=b: c"
+	cfg := newPSSGConfig(siteName, baseURL, "", "repo", "content", "templates", "site", "src")
+
+	overlay := filepath.Join(tmp, "overlay.yml")
+	writeTestFiles(t, tmp, map[string]string{"overlay.yml": `site:
+  description: "Overlay: description"
+taxonomies:
+  - name: team
+    label: Teams
+    field: team
+rss: null
+pagination:
+  per_page: 10
+`})
+	data, err := renderConfig(cfg, overlay, map[string]interface{}{"pagination": map[string]interface{}{"per_page": 99}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got PSSGConfig
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("rendered config is not valid YAML: %v\n%s", err, data)
+	}
+	if got.Site.Name != siteName || got.Site.BaseURL != baseURL {
+		t.Errorf("site = %q, %q, want %q, %q", got.Site.Name, got.Site.BaseURL, siteName, baseURL)
+	}
+	if got.Site.Description != "Overlay: description" || got.Site.Author != cfg.Site.Author {
+		t.Errorf("site not merged: %+v", got.Site)
+	}
+	if len(got.Taxonomies) != 1 || got.Taxonomies[0].Name != "team" {
+		t.Errorf("taxonomies = %+v, want only the overlay's", got.Taxonomies)
+	}
+	if strings.Contains(string(data), "\nrss:") {
+		t.Errorf("rss not removed:\n%s", data)
+	}
+	if got.Pagination.PerPage != 99 || got.Pagination.URLPattern != cfg.Pagination.URLPattern {
+		t.Errorf("pagination = %+v, want the override merged last", got.Pagination)
+	}
+
+	for name, content := range map[string]string{
+		"list.yml":    "- a\n- b\n",
+		"invalid.yml": "site: [\n",
+	} {
+		writeTestFiles(t, tmp, map[string]string{name: content})
+		if _, err := renderConfig(cfg, filepath.Join(tmp, name)); err == nil {
+			t.Errorf("%s: rendered without an error", name)
+		}
+	}
+	if _, err := renderConfig(cfg, filepath.Join(tmp, "missing.yml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing overlay: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// frontmatterDelim separates YAML frontmatter from the markdown body.
+var frontmatterDelim = []byte("---\n")
+
+// Entity is a graph2md markdown file with its parsed frontmatter.
+type Entity struct {
+	Path   string
+	Fields map[string]interface{}
+}
+
+// GetString returns a string frontmatter field, or "" if missing.
+func (e *Entity) GetString(key string) string {
+	s, _ := e.Fields[key].(string)
+	return s
+}
+
+// splitFrontmatter splits a markdown file into its frontmatter and body.
+func splitFrontmatter(data []byte) (fm, body []byte, ok bool) {
+	if !bytes.HasPrefix(data, frontmatterDelim) {
+		return nil, data, false
+	}
+	rest := data[len(frontmatterDelim):]
+	end := bytes.Index(rest, append([]byte("\n"), frontmatterDelim...))
+	if end < 0 {
+		return nil, data, false
+	}
+	return rest[:end+1], rest[end+1+len(frontmatterDelim):], true
+}
+
+// loadEntities reads the frontmatter of every markdown file in contentDir.
+// Files without frontmatter are skipped.
+func loadEntities(contentDir string) ([]*Entity, error) {
+	var entities []*Entity
+	err := filepath.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".md") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fm, _, ok := splitFrontmatter(data)
+		if !ok {
+			return nil
+		}
+		fields := map[string]interface{}{}
+		if err := yaml.Unmarshal(fm, &fields); err != nil {
+			return fmt.Errorf("parsing frontmatter of %s: %w", path, err)
+		}
+		entities = append(entities, &Entity{Path: path, Fields: fields})
+		return nil
+	})
+	return entities, err
+}
+
+// setFrontmatterFields writes fields into the entity's frontmatter on disk,
+// replacing any existing single-line keys of the same name. Values are
+// written as JSON, which is valid YAML and needs no further quoting.
+func setFrontmatterFields(e *Entity, fields map[string]interface{}) error {
+	data, err := os.ReadFile(e.Path)
+	if err != nil {
+		return err
+	}
+	fm, body, ok := splitFrontmatter(data)
+	if !ok {
+		return fmt.Errorf("%s has no frontmatter", e.Path)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out bytes.Buffer
+	out.Write(frontmatterDelim)
+	for _, line := range strings.SplitAfter(string(fm), "\n") {
+		if line == "" || replacesKey(line, keys) {
+			continue
+		}
+		out.WriteString(line)
+	}
+	for _, k := range keys {
+		v, err := json.Marshal(fields[k])
+		if err != nil {
+			return fmt.Errorf("encoding %s: %w", k, err)
+		}
+		fmt.Fprintf(&out, "%s: %s\n", k, v)
+		e.Fields[k] = fields[k]
+	}
+	out.Write(frontmatterDelim)
+	out.Write(body)
+	return os.WriteFile(e.Path, out.Bytes(), 0644)
+}
+
+// replacesKey reports whether a frontmatter line starts one of keys.
+func replacesKey(line string, keys []string) bool {
+	for _, k := range keys {
+		if strings.HasPrefix(line, k+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Modes for the data-export input.
+const (
+	dataOff  = "off"
+	dataJSON = "json" // graph.json as is
+	dataGzip = "gzip" // graph.json.gz
+)
+
+// dataDir is where the data export is written in the site.
+const dataDir = "data"
+
+// Names of the exported files inside dataDir.
+const (
+	dataContentName  = "content.tar.gz"
+	dataMetadataName = "site-metadata.json"
+)
+
+// DataFile is an exported file, as listed in site-metadata.json.
+type DataFile struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Bytes       int64  `json:"bytes"`
+	SHA256      string `json:"sha256"`
+}
+
+// SiteMetadata is site-metadata.json: what the site was built from, so
+// other tools can use the exported data without calling the API.
+type SiteMetadata struct {
+	Generator       string         `json:"generator"`
+	ArchDocsVersion string         `json:"arch_docs_version,omitempty"`
+	SiteName        string         `json:"site_name"`
+	BaseURL         string         `json:"base_url"`
+	Repository      string         `json:"repository,omitempty"`
+	RepositoryURL   string         `json:"repository_url,omitempty"`
+	Commit          string         `json:"commit,omitempty"`
+	ArchiveDigest   string         `json:"archive_digest,omitempty"` // of the archive sent for analysis
+	Version         string         `json:"version,omitempty"`
+	GeneratedAt     time.Time      `json:"generated_at"`
+	SchemaVersion   string         `json:"schema_version,omitempty"`
+	Counts          map[string]int `json:"counts"`
+	Files           []DataFile     `json:"files"`
+}
+
+// parseDataMode validates the data-export input.
+func parseDataMode(s string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(s)); m {
+	case "", dataOff, "false":
+		return dataOff, nil
+	case dataJSON, "true":
+		return dataJSON, nil
+	case dataGzip:
+		return dataGzip, nil
+	default:
+		return "", fmt.Errorf("invalid data-export %q: use off, json or gzip", s)
+	}
+}
+
+// dataGraphName is the name the graph is exported under.
+func dataGraphName(mode string) string {
+	if mode == dataGzip {
+		return "graph.json.gz"
+	}
+	return "graph.json"
+}
+
+// dataPartial renders the homepage's download links for the export, or
+// nothing if it is off.
+func dataPartial(mode string) string {
+	if mode == dataOff {
+		return ""
+	}
+	var links []string
+	for _, name := range []string{dataGraphName(mode), dataContentName, dataMetadataName} {
+		links = append(links, fmt.Sprintf(`<a href="/%s/%s" download>%s</a>`, dataDir, name, html.EscapeString(name)))
+	}
+	return `<p class="hero-data">Download the data behind this site: ` + strings.Join(links, " · ") + "</p>\n"
+}
+
+// writeDataExport writes the validated graph, a tarball of the generated
+// content and site-metadata.json into siteDir/data. meta is completed with
+// the exported files, whose URLs are relative to meta.BaseURL.
+func writeDataExport(siteDir, mode string, graphJSON []byte, contentDir string, meta *SiteMetadata) error {
+	dir := filepath.Join(siteDir, dataDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	graphName := dataGraphName(mode)
+	if mode == dataGzip {
+		if err := writeGzipFile(filepath.Join(dir, graphName), graphJSON); err != nil {
+			return fmt.Errorf("writing %s: %w", graphName, err)
+		}
+	} else if err := os.WriteFile(filepath.Join(dir, graphName), graphJSON, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", graphName, err)
+	}
+	if err := writeContentTarball(filepath.Join(dir, dataContentName), contentDir); err != nil {
+		return fmt.Errorf("writing %s: %w", dataContentName, err)
+	}
+
+	meta.Files = nil
+	for _, f := range []struct{ name, desc string }{
+		{graphName, "Supermodel code graph: nodes, relationships and domains"},
+		{dataContentName, "Markdown with YAML frontmatter for every entity, as rendered by the site"},
+	} {
+		df, err := describeDataFile(dir, f.name, meta.BaseURL)
+		if err != nil {
+			return err
+		}
+		df.Description = f.desc
+		meta.Files = append(meta.Files, df)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, dataMetadataName), append(data, '\n'), 0644)
+}
+
+// describeDataFile sizes and hashes an exported file.
+func describeDataFile(dir, name, baseURL string) (DataFile, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return DataFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return DataFile{}, err
+	}
+	return DataFile{
+		Name:   name,
+		URL:    strings.TrimRight(baseURL, "/") + "/" + dataDir + "/" + name,
+		Bytes:  n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// writeGzipFile writes data gzip-compressed to path.
+func writeGzipFile(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeContentTarball packs the markdown files of contentDir into a
+// gzip-compressed tarball under a content/ directory.
+func writeContentTarball(path, contentDir string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	err = filepath.Walk(contentDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(p, ".md") {
+			return err
+		}
+		rel, err := filepath.Rel(contentDir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = "content/" + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// appendLLMsData adds a Data section listing the exported files to the
+// site's llms.txt, if pssg generated one, replacing the section a previous
+// run added.
+func appendLLMsData(siteDir string, meta *SiteMetadata) error {
+	path := filepath.Join(siteDir, "llms.txt")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// An incremental build that skipped pssg still has the previous section
+	text := string(data)
+	if i := strings.Index(text, "\n## Data\n"); i >= 0 {
+		text = text[:i+1]
+	}
+	var b strings.Builder
+	b.WriteString(text)
+	if len(text) > 0 && !strings.HasSuffix(text, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString("\n## Data\n\n")
+	b.WriteString(fmt.Sprintf("- [%s](%s/%s/%s): Build metadata and checksums of the files below\n", dataMetadataName, strings.TrimRight(meta.BaseURL, "/"), dataDir, dataMetadataName))
+	for _, f := range meta.Files {
+		b.WriteString(fmt.Sprintf("- [%s](%s): %s\n", f.Name, f.URL, f.Description))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
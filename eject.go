@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// templatesMarker records which bundled template set a directory was
+// ejected from.
+const templatesMarker = ".arch-docs-templates.json"
+
+// TemplatesMarker identifies a bundled template set: Version is derived
+// from the content of every file, so it changes whenever any template does.
+type TemplatesMarker struct {
+	Version         string            `json:"version"`
+	ArchDocsVersion string            `json:"arch_docs_version,omitempty"`
+	Files           map[string]string `json:"files"` // path -> sha256
+}
+
+// runTemplatesCommand implements "arch-docs templates <subcommand>".
+func runTemplatesCommand(args []string) {
+	if len(args) == 0 {
+		fatal("usage: arch-docs templates eject [-force] <dir> | check [flags] [dir]")
+	}
+	switch args[0] {
+	case "eject":
+		flags := flag.NewFlagSet("templates eject", flag.ExitOnError)
+		force := flags.Bool("force", false, "overwrite existing files")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			fatal("usage: arch-docs templates eject [-force] <dir>")
+		}
+		m, err := ejectTemplates(flags.Arg(0), *force)
+		if err != nil {
+			fatal("%v", err)
+		}
+		fmt.Printf("Ejected %d templates (version %s) into %s\n", len(m.Files), m.Version, flags.Arg(0))
+		fmt.Println("Pass the directory as templates-dir to build with it.")
+	case "check":
+		flags := flag.NewFlagSet("templates check", flag.ExitOnError)
+		config := flags.String("config", "", "pssg.yaml overlay the site is built with")
+		taxonomies := flags.String("taxonomies", "", "taxonomies input the site is built with")
+		fields := flags.String("fields", "", "comma-separated extra frontmatter fields the content has")
+		flags.Parse(args[1:])
+		if flags.NArg() > 1 {
+			fatal("usage: arch-docs templates check [-config file] [-taxonomies list] [-fields list] [dir]")
+		}
+		var extra []string
+		for _, f := range strings.Split(*fields, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				extra = append(extra, f)
+			}
+		}
+		ok, err := runTemplatesCheck(flags.Arg(0), *config, *taxonomies, extra)
+		if err != nil {
+			fatal("%v", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	default:
+		fatal("unknown templates subcommand %q", args[0])
+	}
+}
+
+// templateSetMarker hashes every file of a template set.
+func templateSetMarker(src fs.FS) (*TemplatesMarker, error) {
+	m := &TemplatesMarker{Files: map[string]string{}}
+	err := fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path == templatesMarker {
+			return err
+		}
+		data, err := fs.ReadFile(src, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		m.Files[path] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	for _, name := range sortedStringKeys(m.Files) {
+		fmt.Fprintf(h, "%s %s\n", name, m.Files[name])
+	}
+	m.Version = hex.EncodeToString(h.Sum(nil))[:12]
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "(devel)" {
+		m.ArchDocsVersion = info.Main.Version
+	}
+	return m, nil
+}
+
+// ejectTemplates copies the bundled templates and a marker into dir. It
+// refuses to overwrite existing files unless force is set.
+func ejectTemplates(dir string, force bool) (*TemplatesMarker, error) {
+	src := bundledTemplates()
+	m, err := templateSetMarker(src)
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		for name := range m.Files {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+				return nil, fmt.Errorf("%s already exists in %s (use -force to overwrite)", name, dir)
+			}
+		}
+	}
+	if err := stageTemplates(src, dir); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return m, os.WriteFile(filepath.Join(dir, templatesMarker), data, 0644)
+}
+
+// readTemplatesMarker reads the marker of an ejected template directory. It
+// returns nil if there is none.
+func readTemplatesMarker(dir string) (*TemplatesMarker, error) {
+	data, err := os.ReadFile(filepath.Join(dir, templatesMarker))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m TemplatesMarker
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", templatesMarker, err)
+	}
+	return &m, nil
+}
+
+// TemplateChange is a bundled template that differs from an ejected copy.
+type TemplateChange struct {
+	Name    string
+	Removed bool // no longer bundled
+}
+
+// String formats the change for notices.
+func (c TemplateChange) String() string {
+	if c.Removed {
+		return c.Name + " (removed)"
+	}
+	return c.Name
+}
+
+// upstreamTemplateChanges lists the bundled templates that were added,
+// changed or removed since ejected was taken, sorted by name.
+func upstreamTemplateChanges(ejected, bundled *TemplatesMarker) []TemplateChange {
+	var changes []TemplateChange
+	for name, sum := range bundled.Files {
+		if ejected.Files[name] != sum {
+			changes = append(changes, TemplateChange{Name: name})
+		}
+	}
+	for name := range ejected.Files {
+		if _, ok := bundled.Files[name]; !ok {
+			changes = append(changes, TemplateChange{Name: name, Removed: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// sortedStringKeys returns the keys of m in order.
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
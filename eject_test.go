@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpstreamTemplateChanges(t *testing.T) {
+	ejected := &TemplatesMarker{Files: map[string]string{
+		"entity.html":  "a",
+		"hub.html":     "b",
+		"_legacy.html": "c",
+	}}
+	bundled := &TemplatesMarker{Files: map[string]string{
+		"entity.html": "a",
+		"hub.html":    "b2",
+		"_new.html":   "d",
+	}}
+	got := upstreamTemplateChanges(ejected, bundled)
+	want := []TemplateChange{
+		{Name: "_legacy.html", Removed: true},
+		{Name: "_new.html"},
+		{Name: "hub.html"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("upstreamTemplateChanges = %+v, want %+v", got, want)
+	}
+	if s := got[0].String(); s != "_legacy.html (removed)" {
+		t.Errorf("String() = %q", s)
+	}
+}
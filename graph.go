@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// supportedSchemaMajor is the graph schema major version graph2md understands.
+const supportedSchemaMajor = 1
+
+// knownNodeTypes lists the node labels graph2md knows how to render.
+var knownNodeTypes = map[string]bool{
+	"File":               true,
+	"Directory":          true,
+	"Function":           true,
+	"Class":              true,
+	"Type":               true,
+	"Interface":          true,
+	"Variable":           true,
+	"Domain":             true,
+	"Subdomain":          true,
+	"Module":             true,
+	"Repository":         true,
+	"LocalDependency":    true,
+	"ExternalDependency": true,
+}
+
+// Graph is the typed form of the Supermodel API result.
+type Graph struct {
+	SchemaVersion string          `json:"schemaVersion"`
+	Repo          string          `json:"repo"`
+	GeneratedAt   string          `json:"generatedAt"`
+	Graph         GraphBody       `json:"graph"`
+	Domains       []Domain        `json:"domains"`
+	Metadata      json.RawMessage `json:"metadata,omitempty"`
+}
+
+// GraphBody holds the nodes and relationships of the graph.
+type GraphBody struct {
+	Nodes         []Node         `json:"nodes"`
+	Relationships []Relationship `json:"relationships"`
+}
+
+// Node is a single entity in the graph (file, function, class, domain, ...).
+type Node struct {
+	ID         string                 `json:"id"`
+	Labels     []string               `json:"labels"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Relationship is a directed edge between two nodes.
+type Relationship struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	StartNode  string                 `json:"startNode"`
+	EndNode    string                 `json:"endNode"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Domain is an architectural domain with optional subdomains.
+type Domain struct {
+	Name               string   `json:"name"`
+	DescriptionSummary string   `json:"descriptionSummary"`
+	KeyFiles           []string `json:"keyFiles"`
+	Responsibilities   []string `json:"responsibilities"`
+	Subdomains         []Domain `json:"subdomains"`
+}
+
+// Type returns the node's primary label, or "" if it has none.
+func (n Node) Type() string {
+	if len(n.Labels) == 0 {
+		return ""
+	}
+	return n.Labels[0]
+}
+
+// GetString returns a string property, or "" if missing or not a string.
+func (n Node) GetString(key string) string {
+	s, _ := n.Properties[key].(string)
+	return s
+}
+
+// ValidationIssue is a single problem found while validating a graph.
+type ValidationIssue struct {
+	Fatal   bool
+	Message string
+}
+
+// parseGraph decodes the raw API result into a Graph.
+func parseGraph(raw []byte) (*Graph, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("API result is empty")
+	}
+	var g Graph
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, fmt.Errorf("decoding graph: %w", err)
+	}
+	return &g, nil
+}
+
+// validateGraph checks the graph for problems that would otherwise surface
+// later as confusing graph2md or pssg failures. Dangling relationship
+// endpoints, duplicate or missing node IDs and incompatible schema versions
+// are fatal; unknown node types only produce warnings.
+func validateGraph(g *Graph) []ValidationIssue {
+	var issues []ValidationIssue
+	fatalf := func(format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{Fatal: true, Message: fmt.Sprintf(format, args...)})
+	}
+	warnf := func(format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{Message: fmt.Sprintf(format, args...)})
+	}
+
+	if g.SchemaVersion == "" {
+		warnf("graph has no schemaVersion; assuming %d.x", supportedSchemaMajor)
+	} else if major, err := schemaMajor(g.SchemaVersion); err != nil {
+		fatalf("invalid schemaVersion %q: %v", g.SchemaVersion, err)
+	} else if major != supportedSchemaMajor {
+		fatalf("unsupported schemaVersion %q (expected %d.x)", g.SchemaVersion, supportedSchemaMajor)
+	}
+
+	if len(g.Graph.Nodes) == 0 {
+		fatalf("graph contains no nodes")
+	}
+
+	ids := make(map[string]bool, len(g.Graph.Nodes))
+	unknown := map[string]int{}
+	for i, n := range g.Graph.Nodes {
+		if n.ID == "" {
+			fatalf("node #%d has no id", i)
+			continue
+		}
+		if ids[n.ID] {
+			fatalf("duplicate node id %q", n.ID)
+		}
+		ids[n.ID] = true
+		t := n.Type()
+		if t == "" {
+			warnf("node %q has no labels", n.ID)
+		} else if !knownNodeTypes[t] {
+			unknown[t]++
+		}
+	}
+	for _, t := range sortedKeys(unknown) {
+		warnf("unknown node type %q (%d nodes)", t, unknown[t])
+	}
+
+	dangling := 0
+	for _, r := range g.Graph.Relationships {
+		for _, end := range []string{r.StartNode, r.EndNode} {
+			if ids[end] {
+				continue
+			}
+			dangling++
+			// Report the first few precisely; the total follows below.
+			if dangling <= 10 {
+				fatalf("relationship %q (%s) references missing node %q", r.ID, r.Type, end)
+			}
+		}
+	}
+	if dangling > 10 {
+		fatalf("%d dangling relationship endpoints in total", dangling)
+	}
+
+	return issues
+}
+
+// schemaMajor returns the major component of a version string like "1.2.0".
+func schemaMajor(version string) (int, error) {
+	v := strings.TrimPrefix(version, "v")
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		v = v[:i]
+	}
+	return strconv.Atoi(v)
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateGraph(t *testing.T) {
+	// graphJSON builds a graph document from its schema version, nodes and
+	// relationships.
+	graphJSON := func(version, nodes, rels string) string {
+		return fmt.Sprintf(`{"schemaVersion": %q, "repo": "org/repo", "graph": {"nodes": [%s], "relationships": [%s]}}`, version, nodes, rels)
+	}
+	const nodes = `{"id": "f1", "labels": ["File"], "properties": {"path": "main.go"}},
+		{"id": "fn1", "labels": ["Function"], "properties": {"name": "main"}}`
+	const edge = `{"id": "r1", "type": "DEFINES", "startNode": "f1", "endNode": "fn1"}`
+
+	var manyDangling []string
+	for i := 0; i < 6; i++ {
+		manyDangling = append(manyDangling, fmt.Sprintf(`{"id": "d%d", "type": "CALLS", "startNode": "gone%d", "endNode": "gone%d"}`, i, i, i))
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want []ValidationIssue
+	}{
+		{"valid", graphJSON("1.2.0", nodes, edge), nil},
+		{"v-prefixed version", graphJSON("v1.0", nodes, edge), nil},
+		{
+			"no schema version",
+			`{"graph": {"nodes": [{"id": "f1", "labels": ["File"]}]}}`,
+			[]ValidationIssue{{false, "graph has no schemaVersion; assuming 1.x"}},
+		},
+		{
+			"newer schema major",
+			graphJSON("2.0.0", nodes, edge),
+			[]ValidationIssue{{true, `unsupported schemaVersion "2.0.0" (expected 1.x)`}},
+		},
+		{
+			"older schema major",
+			graphJSON("0.9", nodes, edge),
+			[]ValidationIssue{{true, `unsupported schemaVersion "0.9" (expected 1.x)`}},
+		},
+		{
+			"unparseable schema version",
+			graphJSON("latest", nodes, edge),
+			[]ValidationIssue{{true, `invalid schemaVersion "latest": strconv.Atoi: parsing "latest": invalid syntax`}},
+		},
+		{
+			"dangling start and end nodes",
+			graphJSON("1.0", nodes, edge+`, {"id": "r2", "type": "CALLS", "startNode": "fn1", "endNode": "fn9"},
+				{"id": "r3", "type": "IMPORTS", "startNode": "f9", "endNode": "f1"}`),
+			[]ValidationIssue{
+				{true, `relationship "r2" (CALLS) references missing node "fn9"`},
+				{true, `relationship "r3" (IMPORTS) references missing node "f9"`},
+			},
+		},
+		{
+			"unknown node types warn",
+			graphJSON("1.0", nodes+`, {"id": "m1", "labels": ["Macro"]}, {"id": "m2", "labels": ["Macro"]},
+				{"id": "x1", "labels": ["Annotation", "File"]}, {"id": "n1", "labels": []}`, edge),
+			[]ValidationIssue{
+				{false, `node "n1" has no labels`},
+				{false, `unknown node type "Annotation" (1 nodes)`},
+				{false, `unknown node type "Macro" (2 nodes)`},
+			},
+		},
+		{
+			"duplicate and missing node ids",
+			graphJSON("1.0", nodes+`, {"id": "f1", "labels": ["File"]}, {"labels": ["File"]}`, edge),
+			[]ValidationIssue{
+				{true, `duplicate node id "f1"`},
+				{true, "node #3 has no id"},
+			},
+		},
+		{
+			"no nodes",
+			graphJSON("1.0", "", ""),
+			[]ValidationIssue{{true, "graph contains no nodes"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := parseGraph([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := validateGraph(g); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("issues\n got: %+v\nwant: %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Past the first 10 dangling endpoints only the total is reported
+	g, err := parseGraph([]byte(graphJSON("1.0", nodes, strings.Join(manyDangling, ","))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := validateGraph(g)
+	if len(issues) != 11 || issues[10] != (ValidationIssue{true, "12 dangling relationship endpoints in total"}) {
+		t.Errorf("issues for 12 dangling endpoints = %+v", issues)
+	}
+}
+
+func TestParseGraph(t *testing.T) {
+	for _, doc := range []string{"", "null", `{"graph": `} {
+		if _, err := parseGraph([]byte(doc)); err == nil {
+			t.Errorf("parseGraph(%q) succeeded", doc)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const churnWindow = 90 * 24 * time.Hour
+const maxContributors = 3
+const maxHotspots = 50
+
+// FileHistory is the change history of a single file.
+type FileHistory struct {
+	Commits      int
+	RecentChurn  int // lines added + deleted within churnWindow
+	LastModified time.Time
+	Authors      map[string]int
+}
+
+// RepoHistory is the git history of every file in the workspace.
+type RepoHistory struct {
+	Head    time.Time
+	Shallow bool
+	Files   map[string]*FileHistory
+}
+
+// Hotspot is a file ranked by how often it changes relative to its size and
+// coupling.
+type Hotspot struct {
+	Title        string
+	Slug         string
+	FilePath     string
+	Score        float64
+	Commits      int
+	RecentChurn  int
+	Lines        int
+	Coupling     int
+	LastModified string
+}
+
+// readGitHistory reads the non-merge commit log of the workspace. Paths are
+// relative to workspaceDir. It returns nil if workspaceDir is not a git
+// checkout. Cancelling ctx stops git.
+func readGitHistory(ctx context.Context, workspaceDir string) (*RepoHistory, error) {
+	if _, err := gitRun(ctx, workspaceDir, "rev-parse", "--git-dir"); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, nil
+	}
+
+	h := &RepoHistory{Files: map[string]*FileHistory{}}
+	if out, err := gitRun(ctx, workspaceDir, "rev-parse", "--is-shallow-repository"); err == nil {
+		h.Shallow = strings.TrimSpace(out) == "true"
+	}
+
+	out, err := gitRun(ctx, workspaceDir, "log",
+		"--no-merges", "--no-renames", "--relative", "--numstat",
+		"--format=%x1e%aN%x1f%aI")
+	if err != nil {
+		return nil, err
+	}
+
+	var author string
+	var when time.Time
+	var cutoff time.Time
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\x1e") {
+			parts := strings.SplitN(line[1:], "\x1f", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			author = parts[0]
+			when, _ = time.Parse(time.RFC3339, parts[1])
+			// git log is newest first, so the first commit is HEAD.
+			if h.Head.IsZero() {
+				h.Head = when
+				cutoff = when.Add(-churnWindow)
+			}
+			continue
+		}
+
+		// numstat lines: "<added>\t<deleted>\t<path>"; binary files use "-".
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := filepath.ToSlash(fields[2])
+		fh := h.Files[path]
+		if fh == nil {
+			fh = &FileHistory{Authors: map[string]int{}}
+			h.Files[path] = fh
+		}
+		fh.Commits++
+		fh.Authors[author]++
+		if when.After(fh.LastModified) {
+			fh.LastModified = when
+		}
+		if !when.Before(cutoff) {
+			added, _ := strconv.Atoi(fields[0])
+			deleted, _ := strconv.Atoi(fields[1])
+			fh.RecentChurn += added + deleted
+		}
+	}
+	return h, scanner.Err()
+}
+
+// TopContributors returns up to n authors ordered by commit count.
+func (fh *FileHistory) TopContributors(n int) []string {
+	names := make([]string, 0, len(fh.Authors))
+	for a := range fh.Authors {
+		names = append(names, a)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if fh.Authors[names[i]] != fh.Authors[names[j]] {
+			return fh.Authors[names[i]] > fh.Authors[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	return names
+}
+
+// attachHistory adds change history fields to every file-backed entity and
+// returns the files ranked as hotspots. The hotspot score (0-100) multiplies
+// normalized recent churn with the average of normalized size and coupling,
+// so large, highly connected files that change often rank first.
+func attachHistory(entities []*Entity, h *RepoHistory, workspaceDir string) ([]Hotspot, error) {
+	type candidate struct {
+		e    *Entity
+		spot Hotspot
+	}
+	var files []candidate
+	var maxChurn, maxLines, maxCoupling float64
+	lineCounts := map[string]int{}
+
+	for _, e := range entities {
+		filePath := e.GetString("file_path")
+		if filePath == "" {
+			continue
+		}
+		fh := h.Files[filepath.ToSlash(filePath)]
+		if fh == nil {
+			continue
+		}
+		fields := map[string]interface{}{
+			"commit_count":      fh.Commits,
+			"recent_churn":      fh.RecentChurn,
+			"last_modified":     fh.LastModified.UTC().Format("2006-01-02"),
+			"contributors":      fh.TopContributors(maxContributors),
+			"contributors_text": strings.Join(fh.TopContributors(maxContributors), ", "),
+		}
+		if err := setFrontmatterFields(e, fields); err != nil {
+			return nil, err
+		}
+
+		// Hotspots are ranked per file, not per function or class.
+		if e.GetString("node_type") != "File" {
+			continue
+		}
+		lines, ok := lineCounts[filePath]
+		if !ok {
+			lines = countLines(filepath.Join(workspaceDir, filePath))
+			lineCounts[filePath] = lines
+		}
+		coupling := intField(e, "import_count") + intField(e, "imported_by_count")
+		files = append(files, candidate{e: e, spot: Hotspot{
+			Title:        e.GetString("title"),
+			Slug:         strings.TrimSuffix(filepath.Base(e.Path), ".md"),
+			FilePath:     filePath,
+			Commits:      fh.Commits,
+			RecentChurn:  fh.RecentChurn,
+			Lines:        lines,
+			Coupling:     coupling,
+			LastModified: fh.LastModified.UTC().Format("2006-01-02"),
+		}})
+		maxChurn = math.Max(maxChurn, float64(fh.RecentChurn))
+		maxLines = math.Max(maxLines, float64(lines))
+		maxCoupling = math.Max(maxCoupling, float64(coupling))
+	}
+
+	var hotspots []Hotspot
+	for _, c := range files {
+		churn := ratio(float64(c.spot.RecentChurn), maxChurn)
+		size := ratio(float64(c.spot.Lines), maxLines)
+		coupling := ratio(float64(c.spot.Coupling), maxCoupling)
+		score := math.Round(100*churn*(size+coupling)/2*10) / 10
+		if err := setFrontmatterFields(c.e, map[string]interface{}{"hotspot_score": score}); err != nil {
+			return nil, err
+		}
+		if score > 0 {
+			c.spot.Score = score
+			hotspots = append(hotspots, c.spot)
+		}
+	}
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Score != hotspots[j].Score {
+			return hotspots[i].Score > hotspots[j].Score
+		}
+		return hotspots[i].FilePath < hotspots[j].FilePath
+	})
+	if len(hotspots) > maxHotspots {
+		hotspots = hotspots[:maxHotspots]
+	}
+	return hotspots, nil
+}
+
+// ratio returns v/max, or 0 when max is 0.
+func ratio(v, max float64) float64 {
+	if max == 0 {
+		return 0
+	}
+	return v / max
+}
+
+// intField returns an integer frontmatter field, or 0 if missing.
+func intField(e *Entity, key string) int {
+	switch v := e.Fields[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// countLines returns the number of lines in a file, or 0 if unreadable.
+func countLines(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return 0
+	}
+	n := bytes.Count(data, []byte("\n"))
+	if data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// hotspotsPageBody is the body of hotspots.html.
+const hotspotsPageBody = `{{if .}}
+    <table class="report-table">
+      <thead>
+        <tr><th>#</th><th>File</th><th>Score</th><th>Commits</th><th>Recent churn</th><th>Lines</th><th>Coupling</th><th>Last modified</th></tr>
+      </thead>
+      <tbody>
+        {{range $i, $h := .}}
+        <tr>
+          <td>{{add $i 1}}</td>
+          <td><a href="/{{$h.Slug}}.html">{{$h.FilePath}}</a></td>
+          <td>{{printf "%.1f" $h.Score}}</td>
+          <td>{{$h.Commits}}</td>
+          <td>{{$h.RecentChurn}}</td>
+          <td>{{$h.Lines}}</td>
+          <td>{{$h.Coupling}}</td>
+          <td>{{$h.LastModified}}</td>
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+    {{else}}
+    <p class="text-muted">No files changed within the churn window.</p>
+    {{end}}
+`
+
+// writeHotspotsPage renders hotspots.html into the output directory.
+func writeHotspotsPage(tplDir, outputDir string, site SiteInfo, hotspots []Hotspot) error {
+	desc := fmt.Sprintf("Files that changed most in the %d days before the latest commit, weighted by size and coupling.", int(churnWindow.Hours()/24))
+	return renderSitePage(tplDir, outputDir, "hotspots.html", site, "Hotspots", desc, hotspotsPageBody, hotspots)
+}
+
+// sitemapURLPattern matches a sitemap <url> entry with its location.
+var sitemapURLPattern = regexp.MustCompile(`(?s)<url>\s*<loc>([^<]*)</loc>.*?</url>`)
+
+// sitemapLastmodPattern matches a <lastmod> element inside a <url> entry.
+var sitemapLastmodPattern = regexp.MustCompile(`<lastmod>[^<]*</lastmod>`)
+
+// applySitemapLastmod rewrites <lastmod> in every sitemap XML file in
+// outputDir, using the commit date of the entity each URL points to. Only
+// entity URLs (a single path segment below baseURL) are changed.
+func applySitemapLastmod(outputDir, baseURL string, lastmod map[string]string) error {
+	files, err := filepath.Glob(filepath.Join(outputDir, "sitemap*.xml"))
+	if err != nil {
+		return err
+	}
+	base := strings.TrimRight(baseURL, "/")
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out := sitemapURLPattern.ReplaceAllStringFunc(string(data), func(entry string) string {
+			loc := strings.TrimSpace(sitemapURLPattern.FindStringSubmatch(entry)[1])
+			rel := strings.TrimPrefix(loc, base+"/")
+			if rel == loc {
+				return entry
+			}
+			slug := strings.TrimSuffix(strings.TrimSuffix(rel, "/"), ".html")
+			date, ok := lastmod[slug]
+			if !ok || strings.Contains(slug, "/") {
+				return entry
+			}
+			tag := "<lastmod>" + date + "</lastmod>"
+			if sitemapLastmodPattern.MatchString(entry) {
+				return sitemapLastmodPattern.ReplaceAllString(entry, tag)
+			}
+			return strings.Replace(entry, "</loc>", "</loc>"+tag, 1)
+		})
+		if out != string(data) {
+			if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+)
+
+func TestReadGitHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ws := t.TempDir()
+	gitTest(t, ws, "init", "-q")
+	writeTestFiles(t, ws, map[string]string{"a.go": "package a\n", "b.go": "package b\n"})
+	gitTest(t, ws, "add", "-A")
+	gitTest(t, ws, "commit", "-q", "-m", "Add files")
+	writeTestFiles(t, ws, map[string]string{"a.go": "package a\n\nvar x = 1\n"})
+	gitTest(t, ws, "commit", "-q", "-am", "Change a")
+
+	h, err := readGitHistory(context.Background(), ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil {
+		t.Fatal("git checkout read as no history")
+	}
+	if got := h.Files["a.go"]; got == nil || got.Commits != 2 || got.Authors["test"] != 2 {
+		t.Errorf("a.go history = %+v, want 2 commits by test", got)
+	}
+	if got := h.Files["b.go"]; got == nil || got.Commits != 1 {
+		t.Errorf("b.go history = %+v, want 1 commit", got)
+	}
+
+	if h, err := readGitHistory(context.Background(), t.TempDir()); h != nil || err != nil {
+		t.Errorf("plain directory = %v, %v, want no history", h, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := readGitHistory(ctx, ws); err == nil {
+		t.Error("history read with a cancelled context")
+	}
+}
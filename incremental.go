@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// buildManifestName is the incremental build manifest kept in the site dir.
+// syncToS3 and publishToBranch leave it out of the deployed site.
+const buildManifestName = ".arch-docs-build.json"
+
+// buildManifestVersion is bumped whenever the manifest format or the way
+// pages are produced changes, forcing a full rebuild.
+const buildManifestVersion = 1
+
+// entityStubTemplate replaces the entity template in the aggregate build,
+// which only needs hub, taxonomy, search and sitemap output.
+const entityStubTemplate = "_entity_stub.html"
+
+// BuildManifest records what the site in a directory was built from.
+type BuildManifest struct {
+	Version    int               `json:"version"`
+	GlobalHash string            `json:"global_hash"`
+	Entities   map[string]string `json:"entities"` // slug -> content hash
+}
+
+// IncrementalPlan describes what an incremental build has to regenerate.
+type IncrementalPlan struct {
+	Manifest *BuildManifest // manifest to write once the build succeeds
+	Full     bool
+	Reason   string
+	Changed  []string // slugs of new or changed entities
+	Removed  []string // slugs of entities that no longer exist
+}
+
+// entitySlug returns the page slug of an entity, which pssg takes from the
+// markdown filename.
+func entitySlug(e *Entity) string {
+	return strings.TrimSuffix(filepath.Base(e.Path), ".md")
+}
+
+// planIncrementalBuild compares the inputs of this run with the manifest of
+// the previous build in siteDir. Any change to templates, config or path
+// prefix requires a full build; otherwise only entities whose markdown or
+// source file changed are re-rendered.
+func planIncrementalBuild(siteDir string, entities []*Entity, tplDir string, cfg *PSSGConfig, overlayPath, sourceDir, pathPrefix string) (*IncrementalPlan, error) {
+	global, err := globalBuildHash(tplDir, cfg, overlayPath, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+	m := &BuildManifest{Version: buildManifestVersion, GlobalHash: global, Entities: map[string]string{}}
+	for _, e := range entities {
+		h, err := entityHash(e, sourceDir)
+		if err != nil {
+			return nil, err
+		}
+		m.Entities[entitySlug(e)] = h
+	}
+	plan := &IncrementalPlan{Manifest: m}
+
+	prev, err := readBuildManifest(siteDir)
+	switch {
+	case err != nil:
+		plan.Full, plan.Reason = true, fmt.Sprintf("unreadable build manifest (%v)", err)
+	case prev == nil:
+		plan.Full, plan.Reason = true, "no previous build"
+	case prev.Version != buildManifestVersion:
+		plan.Full, plan.Reason = true, "build manifest format changed"
+	case prev.GlobalHash != global:
+		plan.Full, plan.Reason = true, "templates or config changed"
+	}
+	if plan.Full {
+		return plan, nil
+	}
+
+	for slug, h := range m.Entities {
+		if prev.Entities[slug] != h {
+			plan.Changed = append(plan.Changed, slug)
+		}
+	}
+	for slug := range prev.Entities {
+		if _, ok := m.Entities[slug]; !ok {
+			plan.Removed = append(plan.Removed, slug)
+		}
+	}
+	sort.Strings(plan.Changed)
+	sort.Strings(plan.Removed)
+	return plan, nil
+}
+
+// globalBuildHash hashes everything that affects every page: the staged
+// templates, the merged config (without the per-run temp paths), the raw
+// overlay and the path prefix.
+func globalBuildHash(tplDir string, cfg *PSSGConfig, overlayPath, pathPrefix string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "prefix:%s\n", pathPrefix)
+
+	normalized := *cfg
+	normalized.Paths = PathsConfig{}
+	data, err := yaml.Marshal(&normalized)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+
+	if overlayPath != "" {
+		data, err := os.ReadFile(overlayPath)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+	}
+
+	var files []string
+	err = filepath.Walk(tplDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		rel, _ := filepath.Rel(tplDir, f)
+		fmt.Fprintf(h, "template:%s\n", filepath.ToSlash(rel))
+		if err := hashFileInto(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// entityHash hashes an entity's markdown and, for file-backed entities, the
+// source file pssg embeds in the page.
+func entityHash(e *Entity, sourceDir string) (string, error) {
+	h := sha256.New()
+	if err := hashFileInto(h, e.Path); err != nil {
+		return "", err
+	}
+	if fp := e.GetString("file_path"); fp != "" {
+		// A missing source file just renders without source code.
+		_ = hashFileInto(h, filepath.Join(sourceDir, fp))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFileInto writes the contents of path into w.
+func hashFileInto(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// readBuildManifest reads the build manifest from siteDir. It returns nil if
+// the directory has none.
+func readBuildManifest(siteDir string) (*BuildManifest, error) {
+	data, err := os.ReadFile(filepath.Join(siteDir, buildManifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m BuildManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// writeBuildManifest writes the build manifest into siteDir.
+func writeBuildManifest(siteDir string, m *BuildManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(siteDir, buildManifestName), data, 0644)
+}
+
+// writeChangedContent copies the markdown of the changed entities into dir,
+// so pssg only renders their entity pages.
+func writeChangedContent(dir string, entities []*Entity, changed []string) error {
+	want := make(map[string]bool, len(changed))
+	for _, slug := range changed {
+		want[slug] = true
+	}
+	for _, e := range entities {
+		if !want[entitySlug(e)] {
+			continue
+		}
+		if err := copyFile(e.Path, filepath.Join(dir, filepath.Base(e.Path))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEntityStub writes the stub entity template used by the aggregate build.
+func writeEntityStub(tplDir string) error {
+	return os.WriteFile(filepath.Join(tplDir, entityStubTemplate), []byte("{{/* entity pages are rendered separately in incremental builds */}}\n"), 0644)
+}
+
+// entityPageFiles returns the site-relative paths an entity page may be
+// written to.
+func entityPageFiles(slug string) []string {
+	return []string{slug + ".html", filepath.Join(slug, "index.html")}
+}
+
+// mergeIncrementalBuild updates siteDir from the two partial builds: entity
+// pages of changed entities come from entityDir, every other file from
+// aggregateDir. Files are only written when their content differs, pages of
+// removed entities are deleted, and so are non-entity files the aggregate
+// build no longer produces. It returns the number of files written and
+// deleted.
+func mergeIncrementalBuild(siteDir, entityDir, aggregateDir string, plan *IncrementalPlan) (written, deleted int, err error) {
+	isEntityPage := map[string]bool{}
+	for slug := range plan.Manifest.Entities {
+		for _, f := range entityPageFiles(slug) {
+			isEntityPage[f] = true
+		}
+	}
+
+	for _, slug := range plan.Changed {
+		for _, f := range entityPageFiles(slug) {
+			n, err := syncFile(filepath.Join(entityDir, f), filepath.Join(siteDir, f))
+			if err != nil {
+				return written, deleted, err
+			}
+			written += n
+		}
+	}
+	for _, slug := range plan.Removed {
+		for _, f := range entityPageFiles(slug) {
+			if err := os.Remove(filepath.Join(siteDir, f)); err == nil {
+				deleted++
+			}
+		}
+	}
+
+	produced := map[string]bool{}
+	err = filepath.Walk(aggregateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(aggregateDir, path)
+		if isEntityPage[rel] {
+			return nil
+		}
+		produced[rel] = true
+		n, err := syncFile(path, filepath.Join(siteDir, rel))
+		written += n
+		return err
+	})
+	if err != nil {
+		return written, deleted, err
+	}
+
+	var stale []string
+	err = filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(siteDir, path)
+		if rel == buildManifestName || isEntityPage[rel] || produced[rel] {
+			return nil
+		}
+		stale = append(stale, path)
+		return nil
+	})
+	if err != nil {
+		return written, deleted, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return written, deleted, err
+		}
+		deleted++
+	}
+	return written, deleted, nil
+}
+
+// syncFile copies src to dst unless dst already has the same content. It
+// returns 1 if dst was written, and 0 if src does not exist.
+func syncFile(src, dst string) (int, error) {
+	data, err := os.ReadFile(src)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if cur, err := os.ReadFile(dst); err == nil && bytes.Equal(cur, data) {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	return 1, os.WriteFile(dst, data, 0644)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanIncrementalBuild(t *testing.T) {
+	tmp := t.TempDir()
+	content := filepath.Join(tmp, "content")
+	source := filepath.Join(tmp, "src")
+	tplDir := filepath.Join(tmp, "templates")
+	siteDir := filepath.Join(tmp, "site")
+	overlay := filepath.Join(tmp, "overlay.yml")
+	writeTestFiles(t, content, map[string]string{
+		"a.md": "---\ntitle: A\nfile_path: a.go\n---\n",
+		"b.md": "---\ntitle: B\nfile_path: b.go\n---\n",
+		"c.md": "---\ntitle: C\n---\n",
+	})
+	writeTestFiles(t, source, map[string]string{"a.go": "package a\n", "b.go": "package b\n"})
+	writeTestFiles(t, tplDir, map[string]string{"entity.html": "{{.Entity.GetString \"title\"}}"})
+	writeTestFiles(t, tmp, map[string]string{"overlay.yml": "site:\n  name: Docs\n"})
+	if err := os.MkdirAll(siteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newPSSGConfig("Docs", "https://example.com", "", "repo", content, tplDir, siteDir, source)
+
+	plan := func(cfg *PSSGConfig, prefix string) *IncrementalPlan {
+		t.Helper()
+		entities, err := loadEntities(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := planIncrementalBuild(siteDir, entities, tplDir, cfg, overlay, source, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	first := plan(cfg, "/repo")
+	if !first.Full || first.Reason != "no previous build" {
+		t.Fatalf("first build: Full=%v %q, want a full build", first.Full, first.Reason)
+	}
+	if err := writeBuildManifest(siteDir, first.Manifest); err != nil {
+		t.Fatal(err)
+	}
+	if p := plan(cfg, "/repo"); p.Full || len(p.Changed) != 0 || len(p.Removed) != 0 {
+		t.Errorf("unchanged inputs: %+v, want nothing to rebuild", p)
+	}
+
+	// Per-entity changes: markdown, source file, new and removed entities
+	writeTestFiles(t, content, map[string]string{"a.md": "---\ntitle: A2\nfile_path: a.go\n---\n", "d.md": "---\ntitle: D\n---\n"})
+	writeTestFiles(t, source, map[string]string{"b.go": "package b\n\nvar x int\n"})
+	if err := os.Remove(filepath.Join(content, "c.md")); err != nil {
+		t.Fatal(err)
+	}
+	p := plan(cfg, "/repo")
+	if p.Full {
+		t.Fatalf("entity changes forced a full build: %s", p.Reason)
+	}
+	if got := strings.Join(p.Changed, ","); got != "a,b,d" {
+		t.Errorf("Changed = %s, want a,b,d", got)
+	}
+	if got := strings.Join(p.Removed, ","); got != "c" {
+		t.Errorf("Removed = %s, want c", got)
+	}
+	if err := writeBuildManifest(siteDir, p.Manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Anything that affects every page forces a full build
+	changedCfg := *cfg
+	changedCfg.Site.Name = "Other"
+	tests := []struct {
+		name   string
+		cfg    *PSSGConfig
+		prefix string
+		files  map[string]string // written under tmp for the case, then restored
+	}{
+		{"config", &changedCfg, "/repo", nil},
+		{"prefix", cfg, "/other", nil},
+		{"template", cfg, "/repo", map[string]string{"templates/entity.html": "{{.Entity.GetString \"description\"}}"}},
+		{"new template", cfg, "/repo", map[string]string{"templates/_custom.css": "a{}"}},
+		{"overlay", cfg, "/repo", map[string]string{"overlay.yml": "site:\n  name: Other\n"}},
+	}
+	for _, tt := range tests {
+		saved := map[string][]byte{}
+		for name := range tt.files {
+			saved[name], _ = os.ReadFile(filepath.Join(tmp, name))
+		}
+		writeTestFiles(t, tmp, tt.files)
+		if p := plan(tt.cfg, tt.prefix); !p.Full || p.Reason != "templates or config changed" {
+			t.Errorf("%s change: Full=%v %q, want a full build", tt.name, p.Full, p.Reason)
+		}
+		for name, data := range saved {
+			path := filepath.Join(tmp, name)
+			if data == nil {
+				os.Remove(path)
+			} else if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if p := plan(cfg, "/repo"); p.Full {
+			t.Fatalf("%s change not undone: %s", tt.name, p.Reason)
+		}
+	}
+
+	// So does a manifest in an older format
+	old := *p.Manifest
+	old.Version = buildManifestVersion - 1
+	if err := writeBuildManifest(siteDir, &old); err != nil {
+		t.Fatal(err)
+	}
+	if p := plan(cfg, "/repo"); !p.Full {
+		t.Error("old manifest format did not force a full build")
+	}
+}
+
+func TestMergeIncrementalBuild(t *testing.T) {
+	tmp := t.TempDir()
+	siteDir := filepath.Join(tmp, "site")
+	entityDir := filepath.Join(tmp, "entity")
+	aggregateDir := filepath.Join(tmp, "aggregate")
+	writeTestFiles(t, siteDir, map[string]string{
+		buildManifestName:  "{}",
+		"a.html":           "old a",
+		"b.html":           "b",
+		"c.html":           "c",
+		"c/index.html":     "c",
+		"index.html":       "old index",
+		"hub-old.html":     "no longer produced",
+		"_assets/site.css": "body{}",
+	})
+	writeTestFiles(t, entityDir, map[string]string{"a.html": "new a"})
+	writeTestFiles(t, aggregateDir, map[string]string{
+		"b.html":           "", // entity stub output
+		"index.html":       "new index",
+		"sitemap.xml":      "<urlset/>",
+		"_assets/site.css": "body{}",
+	})
+	plan := &IncrementalPlan{
+		Manifest: &BuildManifest{Entities: map[string]string{"a": "2", "b": "1"}},
+		Changed:  []string{"a"},
+		Removed:  []string{"c"},
+	}
+
+	written, deleted, err := mergeIncrementalBuild(siteDir, entityDir, aggregateDir, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 3 || deleted != 3 {
+		t.Errorf("written, deleted = %d, %d, want 3, 3", written, deleted)
+	}
+	want := map[string]string{
+		buildManifestName:  "{}",
+		"a.html":           "new a",
+		"b.html":           "b",
+		"index.html":       "new index",
+		"sitemap.xml":      "<urlset/>",
+		"_assets/site.css": "body{}",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(siteDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", name, data, content)
+		}
+	}
+	for _, name := range []string{"c.html", "c/index.html", "hub-old.html"} {
+		if _, err := os.Stat(filepath.Join(siteDir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s was not deleted", name)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// journalName is the stage journal inside the work directory.
+const journalName = "journal.json"
+
+// Resumable stages, in pipeline order. Each stage's artifacts are kept in
+// the work directory, so a later run can pick up after it.
+const (
+	resumeArchive = "archive" // repo.zip
+	resumeAnalyze = "analyze" // graph.json
+	resumeContent = "content" // content/, graph2md output
+	resumeRender  = "render"  // pssg.yaml, templates and the built site
+)
+
+// resumeAuto resumes after the last stage the journal has completed.
+const resumeAuto = "auto"
+
+// resumeStages lists the resumable stages in order.
+var resumeStages = []string{resumeArchive, resumeAnalyze, resumeContent, resumeRender}
+
+// Journal records which stages completed in a work directory, and for which
+// commit.
+type Journal struct {
+	Commit    string               `json:"commit,omitempty"`
+	Completed map[string]time.Time `json:"completed"`
+
+	path string
+}
+
+// parseResumeFrom validates the resume-from input.
+func parseResumeFrom(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == resumeAuto || stageIndex(s) >= 0 {
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid resume-from %q: use auto, %s", s, strings.Join(resumeStages, ", "))
+}
+
+// stageIndex returns the position of a resumable stage, or -1.
+func stageIndex(stage string) int {
+	for i, s := range resumeStages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+// openJournal reads the journal of workDir. A missing journal is empty.
+func openJournal(workDir string) (*Journal, error) {
+	j := &Journal{Completed: map[string]time.Time{}, path: filepath.Join(workDir, journalName)}
+	data, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", j.path, err)
+	}
+	if j.Completed == nil {
+		j.Completed = map[string]time.Time{}
+	}
+	return j, nil
+}
+
+// resumePoint returns the first stage to run. from is "" to run every
+// stage, auto, or a stage name. Auto resumes after the last stage completed
+// for commit, and starts over if the journal is for another commit. Starting
+// a stage clears the later ones, so the completed stages are always a
+// prefix, except for archive when the graph came from graph-file.
+//
+// Resuming at a named stage requires the stage before it to have completed,
+// except for analyze when graphCached is set: it then reads graph-file and
+// needs no archive. A commit mismatch is only warned about, since the caller
+// asked for it.
+func (j *Journal) resumePoint(from, commit string, graphCached bool) (string, error) {
+	switch from {
+	case "":
+		return resumeStages[0], nil
+	case resumeAuto:
+		if j.Commit != commit {
+			return resumeStages[0], nil
+		}
+		for i := len(resumeStages) - 2; i >= 0; i-- {
+			if j.done(resumeStages[i]) {
+				return resumeStages[i+1], nil
+			}
+		}
+		return resumeStages[0], nil
+	}
+	i := stageIndex(from)
+	if i > 0 && !j.done(resumeStages[i-1]) && !(from == resumeAnalyze && graphCached) {
+		return "", fmt.Errorf("cannot resume from %s: %s has not completed in %s", from, resumeStages[i-1], filepath.Dir(j.path))
+	}
+	if i > 0 && j.Commit != commit {
+		fmt.Printf("::warning::Resuming from %s with artifacts of commit %s, not %s\n", from, shortSHA(j.Commit), shortSHA(commit))
+	}
+	return from, nil
+}
+
+// done reports whether stage has completed.
+func (j *Journal) done(stage string) bool {
+	_, ok := j.Completed[stage]
+	return ok
+}
+
+// start records that stage is about to run for commit. Its artifacts and
+// those of every later stage are no longer valid until it completes. A nil
+// journal, for a temporary work directory, records nothing.
+func (j *Journal) start(stage, commit string) error {
+	if j == nil {
+		return nil
+	}
+	for _, s := range resumeStages[stageIndex(stage):] {
+		delete(j.Completed, s)
+	}
+	j.Commit = commit
+	return j.save()
+}
+
+// complete records that stage has completed.
+func (j *Journal) complete(stage string) error {
+	if j == nil {
+		return nil
+	}
+	j.Completed[stage] = time.Now().UTC()
+	return j.save()
+}
+
+// save writes the journal.
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(j.path, data, 0644)
+}
+
+// shortSHA abbreviates a commit for messages.
+func shortSHA(sha string) string {
+	if sha == "" {
+		return "(unknown)"
+	}
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJournalResumePoint(t *testing.T) {
+	const commit = "abc1234"
+	tests := []struct {
+		name        string
+		commit      string
+		completed   []string
+		from        string
+		graphCached bool
+		want        string
+		wantErr     bool
+	}{
+		{name: "no resume", completed: []string{resumeArchive, resumeAnalyze}, from: "", want: resumeArchive},
+		{name: "auto, nothing completed", from: resumeAuto, want: resumeArchive},
+		{name: "auto after content", completed: []string{resumeArchive, resumeAnalyze, resumeContent}, from: resumeAuto, want: resumeRender},
+		{name: "auto with graph-file", completed: []string{resumeAnalyze}, from: resumeAuto, graphCached: true, want: resumeContent},
+		{name: "auto, other commit", commit: "def5678", completed: []string{resumeArchive, resumeAnalyze}, from: resumeAuto, want: resumeArchive},
+		{name: "explicit render", completed: []string{resumeArchive, resumeAnalyze, resumeContent}, from: resumeRender, want: resumeRender},
+		{name: "explicit render, content missing", completed: []string{resumeArchive, resumeAnalyze}, from: resumeRender, wantErr: true},
+		{name: "explicit analyze, archive missing", from: resumeAnalyze, wantErr: true},
+		{name: "explicit analyze with graph-file", from: resumeAnalyze, graphCached: true, want: resumeAnalyze},
+		{name: "explicit content with graph-file, analyze missing", from: resumeContent, graphCached: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := openJournal(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			j.Commit = commit
+			if tt.commit != "" {
+				j.Commit = tt.commit
+			}
+			for _, s := range tt.completed {
+				if err := j.complete(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := j.resumePoint(tt.from, commit, tt.graphCached)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resumePoint error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resumePoint = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Link check modes for the link-check input.
+const (
+	linkCheckOff  = "off"
+	linkCheckWarn = "warn"
+	linkCheckFail = "fail"
+)
+
+// maxAnnotatedPages caps how many source pages get a workflow annotation;
+// the rest are only listed in the log.
+const maxAnnotatedPages = 20
+
+// fetchTargetPattern matches fetch() calls with a constant URL.
+var fetchTargetPattern = regexp.MustCompile(`\bfetch\(\s*["']([^"'+]*)["']\s*\)`)
+
+// BrokenLink is an internal link whose target does not exist in the site.
+type BrokenLink struct {
+	Target string
+	Reason string
+}
+
+// LinkReport lists the broken links of every page that has any.
+type LinkReport struct {
+	Pages   map[string][]BrokenLink // site-relative source page -> broken links
+	Checked int
+	Broken  int
+}
+
+// parseLinkCheckMode validates the link-check input.
+func parseLinkCheckMode(s string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(s)); m {
+	case "", linkCheckWarn:
+		return linkCheckWarn, nil
+	case linkCheckOff, "false":
+		return linkCheckOff, nil
+	case linkCheckFail, "true":
+		return linkCheckFail, nil
+	default:
+		return "", fmt.Errorf("invalid link-check %q: use off, warn or fail", s)
+	}
+}
+
+// checkLinks resolves every internal href, src, srcset and constant fetch()
+// target of the HTML and JS files in siteDir against the files in siteDir.
+// baseURL is the site's public URL; links to it and root-relative links
+// must include its path prefix, as they will once deployed.
+func checkLinks(siteDir, baseURL string) (*LinkReport, error) {
+	files := map[string]bool{}
+	var sources []string
+	err := filepath.Walk(siteDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(siteDir, p)
+		rel = filepath.ToSlash(rel)
+		files[rel] = true
+		switch strings.ToLower(path.Ext(rel)) {
+		case ".html", ".htm", ".js":
+			sources = append(sources, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sources)
+
+	base := strings.TrimRight(baseURL, "/")
+	prefix := extractPathPrefix(baseURL)
+	report := &LinkReport{Pages: map[string][]BrokenLink{}}
+
+	for _, src := range sources {
+		data, err := os.ReadFile(filepath.Join(siteDir, filepath.FromSlash(src)))
+		if err != nil {
+			return nil, err
+		}
+		var targets []string
+		collect := func(u string) {
+			if f := strings.Fields(u); len(f) > 0 {
+				targets = append(targets, f[0])
+			}
+		}
+		if ext := strings.ToLower(path.Ext(src)); ext != ".js" {
+			prefixRewriter{onURL: collect}.markup(string(data), false)
+		}
+		for _, m := range fetchTargetPattern.FindAllStringSubmatch(string(data), -1) {
+			collect(m[1])
+		}
+
+		seen := map[string]bool{}
+		for _, t := range targets {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			target, internal := internalTarget(t, src, base, prefix)
+			if !internal {
+				continue
+			}
+			report.Checked++
+			if reason := resolveTarget(files, target, prefix); reason != "" {
+				report.Pages[src] = append(report.Pages[src], BrokenLink{Target: t, Reason: reason})
+				report.Broken++
+			}
+		}
+	}
+	return report, nil
+}
+
+// internalTarget turns a link found on page src into a path below the
+// deployment root (still including the path prefix) without query or
+// fragment. internal is false for external, protocol-relative, fragment-only
+// and non-HTTP links.
+func internalTarget(link, src, base, prefix string) (target string, internal bool) {
+	link = strings.TrimSpace(link)
+	if base != "" && (link == base || strings.HasPrefix(link, base+"/")) {
+		link = prefix + strings.TrimPrefix(link, base)
+		if link == "" {
+			link = "/"
+		}
+	}
+	if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "//") {
+		return "", false
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(prefix+"/"+path.Dir(src), p)
+		if strings.HasSuffix(u.Path, "/") {
+			p += "/"
+		}
+	}
+	return p, true
+}
+
+// resolveTarget reports why the root-relative path p does not resolve to a
+// file in the site, or "" if it does. Like GitHub Pages, a directory resolves
+// to its index.html and an extensionless path to the matching .html file.
+func resolveTarget(files map[string]bool, p, prefix string) string {
+	if prefix != "" {
+		if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+			return "outside path prefix " + prefix
+		}
+		p = strings.TrimPrefix(p, prefix)
+	}
+	rel := strings.TrimPrefix(p, "/")
+	if strings.HasSuffix(rel, "/") || rel == "" {
+		if files[rel+"index.html"] {
+			return ""
+		}
+		return "missing"
+	}
+	if files[rel] || files[rel+"/index.html"] || files[rel+".html"] {
+		return ""
+	}
+	return "missing"
+}
+
+// printLinkReport logs broken links grouped by source page, as warnings or
+// errors depending on mode.
+func printLinkReport(r *LinkReport, mode string) {
+	level := "warning"
+	if mode == linkCheckFail {
+		level = "error"
+	}
+	pages := make([]string, 0, len(r.Pages))
+	for p := range r.Pages {
+		pages = append(pages, p)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if len(r.Pages[pages[i]]) != len(r.Pages[pages[j]]) {
+			return len(r.Pages[pages[i]]) > len(r.Pages[pages[j]])
+		}
+		return pages[i] < pages[j]
+	})
+	for i, p := range pages {
+		var targets []string
+		for _, l := range r.Pages[p] {
+			targets = append(targets, fmt.Sprintf("%s (%s)", l.Target, l.Reason))
+		}
+		annotation := ""
+		if i < maxAnnotatedPages {
+			annotation = "::" + level + "::"
+		}
+		fmt.Printf("%sBroken links on %s: %s\n", annotation, p, strings.Join(targets, ", "))
+	}
+	fmt.Printf("Checked %d internal links: %d broken on %d pages\n", r.Checked, r.Broken, len(pages))
+}
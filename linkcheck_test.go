@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLinkCheckMode(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      bool
+	}{
+		{"", linkCheckWarn, false},
+		{"warn", linkCheckWarn, false},
+		{" Fail ", linkCheckFail, false},
+		{"true", linkCheckFail, false},
+		{"off", linkCheckOff, false},
+		{"false", linkCheckOff, false},
+		{"strict", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseLinkCheckMode(tt.in)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("parseLinkCheckMode(%q) = %q, %v, want %q (error: %v)", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestInternalTarget(t *testing.T) {
+	const base, prefix = "https://example.github.io/repo", "/repo"
+	tests := []struct {
+		link, src string
+		want      string
+		internal  bool
+	}{
+		{"/repo/about.html", "index.html", "/repo/about.html", true},
+		{"/repo/guide/", "index.html", "/repo/guide/", true},
+		{"/repo/about.html#team", "index.html", "/repo/about.html", true},
+		{"/repo/search/?q=x", "index.html", "/repo/search/", true},
+		{"https://example.github.io/repo/about.html", "index.html", "/repo/about.html", true},
+		{"https://example.github.io/repo", "index.html", "/repo", true},
+		{"../about.html", "guide/index.html", "/repo/about.html", true},
+		{"sub/", "guide/index.html", "/repo/guide/sub/", true},
+		{"img/logo.png", "index.html", "/repo/img/logo.png", true},
+		{"#top", "index.html", "", false},
+		{"https://github.com/org/repo", "index.html", "", false},
+		{"https://example.github.io/repository/", "index.html", "", false},
+		{"//cdn.example.com/x.js", "index.html", "", false},
+		{"mailto:team@example.com", "index.html", "", false},
+		{"?page=2", "index.html", "", false},
+	}
+	for _, tt := range tests {
+		got, internal := internalTarget(tt.link, tt.src, base, prefix)
+		if got != tt.want || internal != tt.internal {
+			t.Errorf("internalTarget(%q, %q) = %q, %v, want %q, %v", tt.link, tt.src, got, internal, tt.want, tt.internal)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	site := t.TempDir()
+	writeTestFiles(t, site, map[string]string{
+		"index.html": `<a href="/repo/about.html">About</a>
+<a href="/repo/guide/">Guide</a>
+<a href="/repo/guide">Guide</a>
+<a href="/repo/node_type/function">Functions</a>
+<a href="/repo/about.html#team">Team</a>
+<a href="#top">Top</a>
+<a href="https://github.com/org/repo">GitHub</a>
+<a href="https://example.github.io/repo/about.html">About</a>
+<a href="/repo/missing.html">Missing</a>
+<a href="/about.html">Unprefixed</a>
+<img src="img/logo.png" srcset="/repo/img/logo.png 1x, /repo/img/logo@2x.png 2x">`,
+		"guide/index.html":        `<a href="../about.html">About</a><a href="sub/page.html">Sub</a>`,
+		"about.html":              `<a href="./">Home</a>`,
+		"node_type/function.html": "",
+		"img/logo.png":            "png",
+		"app.js":                  `fetch("/repo/search-index.json"); fetch('/repo/about.html'); fetch("/repo/" + name)`,
+	})
+
+	report, err := checkLinks(site, "https://example.github.io/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]BrokenLink{
+		"index.html": {
+			{"/repo/missing.html", "missing"},
+			{"/about.html", "outside path prefix /repo"},
+			{"/repo/img/logo@2x.png", "missing"},
+		},
+		"guide/index.html": {{"sub/page.html", "missing"}},
+		"app.js":           {{"/repo/search-index.json", "missing"}},
+	}
+	if !reflect.DeepEqual(report.Pages, want) {
+		t.Errorf("broken links:\n got: %v\nwant: %v", report.Pages, want)
+	}
+	if report.Checked != 16 || report.Broken != 5 {
+		t.Errorf("checked %d, broken %d, want 16, 5", report.Checked, report.Broken)
+	}
+
+	// The mode decides how broken links are annotated
+	for mode, annotation := range map[string]string{linkCheckWarn: "::warning::", linkCheckFail: "::error::"} {
+		out := captureStdout(t, func() { printLinkReport(report, mode) })
+		if n := strings.Count(out, annotation+"Broken links on "); n != 3 {
+			t.Errorf("%s: %d %s annotations, want 3:\n%s", mode, n, annotation, out)
+		}
+		if !strings.Contains(out, "Checked 16 internal links: 5 broken on 3 pages") {
+			t.Errorf("%s: summary missing:\n%s", mode, out)
+		}
+	}
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-done
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
-	"archive/zip"
 	"bytes"
-	"crypto/rand"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -15,7 +16,10 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 const apiBaseURL = "https://api.supermodeltools.com/v1/graphs/supermodel"
@@ -31,196 +35,50 @@ type APIResponse struct {
 	Result json.RawMessage `json:"result"`
 }
 
-// pssgConfigTemplate is the pssg.yaml configuration template.
-const pssgConfigTemplate = `site:
-  name: "%s"
-  base_url: "%s"
-  repo_url: "%s"
-  description: "Architecture documentation for the %s codebase. Explore files, functions, classes, domains, and dependencies."
-  author: "Supermodel"
-  language: "en"
-
-paths:
-  data: "%s"
-  templates: "%s"
-  output: "%s"
-  source_dir: "%s"
-
-data:
-  format: "markdown"
-  entity_type: "entity"
-  entity_slug:
-    source: "filename"
-  body_sections:
-    - name: "Functions"
-      header: "Functions"
-      type: "unordered_list"
-    - name: "Classes"
-      header: "Classes"
-      type: "unordered_list"
-    - name: "Types"
-      header: "Types"
-      type: "unordered_list"
-    - name: "Dependencies"
-      header: "Dependencies"
-      type: "unordered_list"
-    - name: "Imported By"
-      header: "Imported By"
-      type: "unordered_list"
-    - name: "Calls"
-      header: "Calls"
-      type: "unordered_list"
-    - name: "Called By"
-      header: "Called By"
-      type: "unordered_list"
-    - name: "Source Files"
-      header: "Source Files"
-      type: "unordered_list"
-    - name: "Subdirectories"
-      header: "Subdirectories"
-      type: "unordered_list"
-    - name: "Files"
-      header: "Files"
-      type: "unordered_list"
-    - name: "Source"
-      header: "Source"
-      type: "unordered_list"
-    - name: "Extends"
-      header: "Extends"
-      type: "unordered_list"
-    - name: "Defined In"
-      header: "Defined In"
-      type: "unordered_list"
-    - name: "Subdomains"
-      header: "Subdomains"
-      type: "unordered_list"
-    - name: "Domain"
-      header: "Domain"
-      type: "unordered_list"
-    - name: "faqs"
-      header: "FAQs"
-      type: "faq"
-
-taxonomies:
-  - name: "node_type"
-    label: "Node Types"
-    label_singular: "Node Type"
-    field: "node_type"
-    multi_value: false
-    min_entities: 1
-    index_description: "Browse by entity type"
-
-  - name: "language"
-    label: "Languages"
-    label_singular: "Language"
-    field: "language"
-    multi_value: false
-    min_entities: 1
-    index_description: "Browse by programming language"
-
-  - name: "domain"
-    label: "Domains"
-    label_singular: "Domain"
-    field: "domain"
-    multi_value: false
-    min_entities: 1
-    index_description: "Browse by architectural domain"
-
-  - name: "subdomain"
-    label: "Subdomains"
-    label_singular: "Subdomain"
-    field: "subdomain"
-    multi_value: false
-    min_entities: 1
-    index_description: "Browse by architectural subdomain"
-
-  - name: "top_directory"
-    label: "Top Directories"
-    label_singular: "Directory"
-    field: "top_directory"
-    multi_value: false
-    min_entities: 1
-    index_description: "Browse by top-level directory"
-
-  - name: "extension"
-    label: "File Extensions"
-    label_singular: "Extension"
-    field: "extension"
-    multi_value: false
-    min_entities: 1
-    index_description: "Browse by file extension"
-
-  - name: "tags"
-    label: "Tags"
-    label_singular: "Tag"
-    field: "tags"
-    multi_value: true
-    min_entities: 1
-    index_description: "Browse by tag"
-
-pagination:
-  per_page: 48
-  url_pattern: "/{taxonomy}/{entry}/{page}"
-
-structured_data:
-  entity_type: "SoftwareSourceCode"
-  field_mappings:
-    name: "title"
-    description: "description"
-    programmingLanguage: "language"
-    codeRepository: "repo_url"
-
-sitemap:
-  enabled: true
-  max_urls_per_file: 50000
-  priorities:
-    homepage: 1.0
-    entity: 0.8
-    taxonomy_index: 0.7
-    hub_page_1: 0.6
-    hub_page_n: 0.4
-
-rss:
-  enabled: true
-  title: "%s"
-  description: "Architecture documentation for the %s codebase"
-
-robots:
-  enabled: true
-
-llms_txt:
-  enabled: true
-  title: "%s"
-  description: "Architecture documentation for the %s codebase"
-
-search:
-  enabled: true
-
-templates:
-  entity: "entity.html"
-  homepage: "index.html"
-  hub: "hub.html"
-  taxonomy_index: "taxonomy_index.html"
-  all_entities: "all_entities.html"
-
-output:
-  clean_before_build: true
-  extract_css: "styles.css"
-  extract_js: "main.js"
-
-extra:
-  cta:
-    enabled: true
-    heading: "Analyze Your Own Codebase"
-    description: "Get architecture documentation, dependency graphs, and domain analysis for your codebase in minutes."
-    button_text: "Try Supermodel Free"
-    button_url: "https://dashboard.supermodeltools.com/billing/"
-`
-
 func main() {
-	// Step 1: Read inputs
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "templates":
+			runTemplatesCommand(os.Args[2:])
+			return
+		}
+	}
+
+	// Cancelling the workflow stops polling, kills graph2md and pssg, and
+	// exits with exitCancelled once temporary files are removed.
+	runCtx = cancelOnSignal()
+
+	// Step 1: Read inputs. Flags override the inputs of the same name for
+	// local runs, e.g. arch-docs --work-dir=.arch-docs-work --resume-from=render
+	flags := flag.NewFlagSet("arch-docs", flag.ExitOnError)
+	workDirFlag := flags.String("work-dir", getInput("work-dir"), "persistent work directory; keeps intermediate artifacts for resuming")
+	resumeFlag := flags.String("resume-from", getInput("resume-from"), "stage to resume from: auto, "+strings.Join(resumeStages, ", "))
+	flags.Parse(os.Args[1:])
+
+	format, err := parseLogFormat(getInput("log-format"))
+	if err != nil {
+		fatal("%v", err)
+	}
+	if format == logFormatJSON {
+		if err := startJSONLog(); err != nil {
+			fatal("Failed to start JSON log: %v", err)
+		}
+	}
+
+	// graph-file caches the API response: it is read if it exists and
+	// written after a successful API call otherwise.
+	graphFile := getInput("graph-file")
+	graphCached := false
+	if graphFile != "" {
+		if _, err := os.Stat(graphFile); err == nil {
+			graphCached = true
+		}
+	}
 	apiKey := getInput("supermodel-api-key")
-	if apiKey == "" {
+	if apiKey == "" && !graphCached {
 		fatal("supermodel-api-key input is required")
 	}
 
@@ -228,11 +86,52 @@ func main() {
 	baseURL := getInput("base-url")
 	outputDir := getInput("output-dir")
 	templatesDir := getInput("templates-dir")
+	configOverlay := getInput("pssg-config")
+	taxonomyList := getInput("taxonomies")
+	useCodeOwners := getBoolInput("codeowners", true)
+	useGitHistory := getBoolInput("git-history", true)
+	versionInput := getInput("version")
+	incremental := getBoolInput("incremental", false)
+	linkCheckMode, err := parseLinkCheckMode(getInput("link-check"))
+	if err != nil {
+		fatal("%v", err)
+	}
+	dataMode, err := parseDataMode(getInput("data-export"))
+	if err != nil {
+		fatal("%v", err)
+	}
+	assetsMode, err := parseAssetsMode(getInput("assets"))
+	if err != nil {
+		fatal("%v", err)
+	}
+	if assetsMode == assetsSelfHost {
+		if missing := missingVendorAssets(); len(missing) > 0 {
+			fatal("assets: self-host requires assets embedded at build time, missing %s (run scripts/vendor-assets.sh before go build)", strings.Join(missing, ", "))
+		}
+	}
+	var s3Target *S3Target
+	if bucket := getInput("s3-bucket"); bucket != "" {
+		s3Target, err = newS3Target(bucket, getInput("s3-prefix"), getInput("s3-region"), getInput("s3-endpoint"), getBoolInput("s3-delete", false))
+		if err != nil {
+			fatal("%v", err)
+		}
+	}
 
 	if outputDir == "" {
 		outputDir = "./arch-docs-output"
 	}
 
+	publishBranch := getInput("publish-branch")
+	private := getBoolInput("private", false)
+
+	resumeFrom, err := parseResumeFrom(*resumeFlag)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if resumeFrom != "" && *workDirFlag == "" {
+		fatal("resume-from requires work-dir")
+	}
+
 	// Step 2: Derive repo info
 	ghRepo := os.Getenv("GITHUB_REPOSITORY") // e.g. "owner/repo"
 	repoName := ""
@@ -262,7 +161,11 @@ func main() {
 			if len(parts) == 2 {
 				// Check for custom domain via raw CNAME file in the org's .github.io repo
 				orgPagesURL := "https://" + parts[0] + ".github.io"
-				customDomain := fetchOrgCNAME(parts[0])
+				customDomain := ""
+				if !private {
+					// Private builds make no outbound requests besides the API
+					customDomain = fetchOrgCNAME(parts[0])
+				}
 				if customDomain != "" {
 					orgPagesURL = "https://" + customDomain
 				}
@@ -275,6 +178,10 @@ func main() {
 		}
 	}
 
+	if publishBranch != "" && ghRepo == "" {
+		fatal("publish-branch requires GITHUB_REPOSITORY")
+	}
+
 	workspaceDir := os.Getenv("GITHUB_WORKSPACE")
 	if workspaceDir == "" {
 		workspaceDir = "."
@@ -284,134 +191,696 @@ func main() {
 	if !filepath.IsAbs(outputDir) {
 		outputDir = filepath.Join(workspaceDir, outputDir)
 	}
+	persistentWorkDir := *workDirFlag
+	if persistentWorkDir != "" && !filepath.IsAbs(persistentWorkDir) {
+		persistentWorkDir = filepath.Join(workspaceDir, persistentWorkDir)
+	}
+
+	// The report is written last, after deploying, but a later step
+	// uploading output-dir as a Pages artifact would still publish it, so
+	// it goes into the persistent work dir or, without one, the workspace.
+	// The previous run's report is dropped, so it isn't archived, along
+	// with the one earlier releases left in output-dir.
+	os.Remove(filepath.Join(outputDir, runReportName))
+	reportPath := filepath.Join(workspaceDir, "arch-docs-"+runReportName)
+	if persistentWorkDir != "" {
+		reportPath = filepath.Join(persistentWorkDir, runReportName)
+	}
+	if abs, err := filepath.Abs(reportPath); err == nil {
+		reportPath = abs
+	}
+	os.Remove(reportPath)
+	report.writeTo(reportPath)
+
+	// Versioned builds land in outputDir/<version>/ with their own base URL
+	version := ""
+	if versionInput != "" {
+		v, err := resolveVersion(versionInput)
+		if err != nil {
+			fatal("%v", err)
+		}
+		version = v
+	}
+	rootPrefix := extractPathPrefix(baseURL)
+	siteDir := outputDir
+	siteBaseURL := baseURL
+	if version != "" {
+		siteDir = filepath.Join(outputDir, version)
+		siteBaseURL = strings.TrimRight(baseURL, "/") + "/" + version
+	}
 
-	fmt.Printf("::group::Configuration\n")
+	// Intermediate artifacts live in workDir. A persistent work-dir keeps
+	// them, with a journal of completed stages, so a failed run can resume
+	// without repeating the analysis.
+	var workDir string
+	var journal *Journal
+	commit := os.Getenv("GITHUB_SHA")
+	if commit == "" {
+		if out, err := gitRun(runCtx, workspaceDir, "rev-parse", "HEAD"); err == nil {
+			commit = strings.TrimSpace(out)
+		}
+	}
+	if persistentWorkDir != "" {
+		workDir = persistentWorkDir
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			fatal("Failed to create work dir: %v", err)
+		}
+		journal, err = openJournal(workDir)
+		if err != nil {
+			fatal("Failed to read work dir journal: %v", err)
+		}
+	} else {
+		workDir, err = os.MkdirTemp("", "arch-docs-*")
+		if err != nil {
+			fatal("Failed to create temp dir: %v", err)
+		}
+		tmpDir := workDir
+		atExit(func() { os.RemoveAll(tmpDir) })
+	}
+	resumeAt := resumeStages[0]
+	if journal != nil {
+		resumeAt, err = journal.resumePoint(resumeFrom, commit, graphCached)
+		if err != nil {
+			fatal("%v", err)
+		}
+	}
+	// runs reports whether a resumable stage runs, or its artifacts are reused.
+	runs := func(stage string) bool {
+		return stageIndex(stage) >= stageIndex(resumeAt)
+	}
+
+	logGroup("config", "Configuration")
 	fmt.Printf("Site name: %s\n", siteName)
 	fmt.Printf("Base URL: %s\n", baseURL)
 	fmt.Printf("Output dir: %s\n", outputDir)
+	if version != "" {
+		fmt.Printf("Version: %s\n", version)
+	}
 	fmt.Printf("Repo: %s\n", ghRepo)
 	fmt.Printf("Workspace: %s\n", workspaceDir)
+	if journal != nil {
+		fmt.Printf("Work dir: %s\n", workDir)
+		if resumeAt != resumeStages[0] {
+			fmt.Printf("Resuming from %s\n", resumeAt)
+			report.setResumedFrom(resumeAt)
+		}
+	}
 	logGroupEnd()
 
-	// Step 3: Zip the repo
-	logGroup("Creating repository archive")
-	zipPath, err := createRepoZip(workspaceDir)
-	if err != nil {
-		fatal("Failed to create repo zip: %v", err)
-	}
-	defer os.Remove(zipPath)
+	graphPath := filepath.Join(workDir, "graph.json")
+	var graphJSON []byte
+	archiveSHA := "" // set when the repository is archived for the API
+	if !runs(resumeAnalyze) {
+		logGroup("graph-cache", "Reading graph from work dir")
+		graphJSON, err = os.ReadFile(graphPath)
+		if err != nil {
+			fatal("Failed to read graph: %v", err)
+		}
+		fmt.Printf("Graph data read from %s (%d bytes)\n", graphPath, len(graphJSON))
+		report.addMetric("graph_bytes", int64(len(graphJSON)))
+		logGroupEnd()
+	} else if graphCached {
+		if err := journal.start(resumeAnalyze, commit); err != nil {
+			fatal("Failed to write journal: %v", err)
+		}
+		logGroup("graph-cache", "Reading cached graph")
+		graphJSON, err = os.ReadFile(graphFile)
+		if err != nil {
+			fatal("Failed to read graph file: %v", err)
+		}
+		fmt.Printf("Graph data read from %s (%d bytes)\n", graphFile, len(graphJSON))
+		report.addMetric("graph_bytes", int64(len(graphJSON)))
+		logGroupEnd()
+	} else {
+		// Step 3: Zip the repo
+		zipPath := filepath.Join(workDir, "repo.zip")
+		if runs(resumeArchive) {
+			if err := journal.start(resumeArchive, commit); err != nil {
+				fatal("Failed to write journal: %v", err)
+			}
+			logGroup("zip", "Creating repository archive")
+			if err := createRepoZip(runCtx, workspaceDir, zipPath, workDir); err != nil {
+				fatal("Failed to create repo zip: %v", err)
+			}
+			info, _ := os.Stat(zipPath)
+			fmt.Printf("Archive created: %s (%.2f MB)\n", zipPath, float64(info.Size())/(1024*1024))
+			report.addMetric("archive_bytes", info.Size())
+			logGroupEnd()
+			if err := journal.complete(resumeArchive); err != nil {
+				fatal("Failed to write journal: %v", err)
+			}
+		}
 
-	info, _ := os.Stat(zipPath)
-	fmt.Printf("Archive created: %s (%.2f MB)\n", zipPath, float64(info.Size())/(1024*1024))
-	logGroupEnd()
+		// The digest identifies the archived files: the same commit always
+		// gives the same archive
+		archiveSHA, err = archiveDigest(zipPath)
+		if err != nil {
+			fatal("Failed to hash repo zip: %v", err)
+		}
+		fmt.Printf("Archive digest: %s\n", archiveSHA)
+		report.setArchiveDigest(archiveSHA)
 
-	// Step 4 & 5: Call Supermodel API and poll
-	logGroup("Calling Supermodel API")
-	graphJSON, err := callSupermodelAPI(apiKey, zipPath)
-	if err != nil {
-		fatal("API call failed: %v", err)
+		// Step 4 & 5: Call Supermodel API and poll
+		if err := journal.start(resumeAnalyze, commit); err != nil {
+			fatal("Failed to write journal: %v", err)
+		}
+		logGroup("api", "Calling Supermodel API")
+		graphJSON, err = callSupermodelAPI(runCtx, apiKey, zipPath, archiveSHA)
+		if err != nil {
+			fatal("API call failed: %v", err)
+		}
+		fmt.Printf("Graph data received (%d bytes)\n", len(graphJSON))
+		report.addMetric("graph_bytes", int64(len(graphJSON)))
+		if graphFile != "" {
+			if err := os.WriteFile(graphFile, graphJSON, 0644); err != nil {
+				fatal("Failed to cache graph: %v", err)
+			}
+			fmt.Printf("Graph cached to %s\n", graphFile)
+		}
+		logGroupEnd()
 	}
-	fmt.Printf("Graph data received (%d bytes)\n", len(graphJSON))
-	logGroupEnd()
 
-	// Step 6: Save graph JSON
-	logGroup("Saving graph data")
-	tmpDir, err := os.MkdirTemp("", "arch-docs-*")
+	// Step 5b: Validate graph before handing it to graph2md
+	logGroup("validate", "Validating graph data")
+	graph, err := parseGraph(graphJSON)
 	if err != nil {
-		fatal("Failed to create temp dir: %v", err)
+		fatal("Invalid graph data: %v", err)
 	}
-	defer os.RemoveAll(tmpDir)
-
-	graphPath := filepath.Join(tmpDir, "graph.json")
-	if err := os.WriteFile(graphPath, graphJSON, 0644); err != nil {
-		fatal("Failed to write graph JSON: %v", err)
+	failed := false
+	for _, issue := range validateGraph(graph) {
+		if issue.Fatal {
+			fmt.Printf("::error::%s\n", issue.Message)
+			failed = true
+		} else {
+			fmt.Printf("::warning::%s\n", issue.Message)
+		}
+	}
+	if failed {
+		fatal("Graph validation failed")
 	}
-	fmt.Printf("Graph saved to %s\n", graphPath)
+	fmt.Printf("Graph: %d nodes, %d relationships, %d domains\n",
+		len(graph.Graph.Nodes), len(graph.Graph.Relationships), len(graph.Domains))
+	report.addMetric("nodes", int64(len(graph.Graph.Nodes)))
+	report.addMetric("relationships", int64(len(graph.Graph.Relationships)))
 	logGroupEnd()
 
+	// Step 6: Save graph JSON
+	if runs(resumeAnalyze) {
+		logGroup("save-graph", "Saving graph data")
+		if err := os.WriteFile(graphPath, graphJSON, 0644); err != nil {
+			fatal("Failed to write graph JSON: %v", err)
+		}
+		fmt.Printf("Graph saved to %s\n", graphPath)
+		logGroupEnd()
+		if err := journal.complete(resumeAnalyze); err != nil {
+			fatal("Failed to write journal: %v", err)
+		}
+	}
+
 	// Step 7: Run graph2md
-	logGroup("Generating markdown from graph")
-	contentDir := filepath.Join(tmpDir, "content")
-	if err := os.MkdirAll(contentDir, 0755); err != nil {
-		fatal("Failed to create content dir: %v", err)
+	contentDir := filepath.Join(workDir, "content")
+	if runs(resumeContent) {
+		if err := journal.start(resumeContent, commit); err != nil {
+			fatal("Failed to write journal: %v", err)
+		}
+		logGroup("graph2md", "Generating markdown from graph")
+		// A previous run's content may hold entities the graph no longer has
+		if err := os.RemoveAll(contentDir); err != nil {
+			fatal("Failed to clear content dir: %v", err)
+		}
+		if err := os.MkdirAll(contentDir, 0755); err != nil {
+			fatal("Failed to create content dir: %v", err)
+		}
+
+		graph2mdArgs := []string{
+			"-input", graphPath,
+			"-output", contentDir,
+		}
+		if repoName != "" {
+			graph2mdArgs = append(graph2mdArgs, "-repo", repoName)
+		}
+		if repoURL != "" {
+			graph2mdArgs = append(graph2mdArgs, "-repo-url", repoURL)
+		}
+
+		if err := runCommand(runCtx, "graph2md", graph2mdArgs...); err != nil {
+			fatal("graph2md failed: %v", err)
+		}
+
+		generated := countFiles(contentDir, ".md")
+		fmt.Printf("Generated %d markdown files\n", generated)
+		report.addMetric("markdown_files", int64(generated))
+		logGroupEnd()
+		if err := journal.complete(resumeContent); err != nil {
+			fatal("Failed to write journal: %v", err)
+		}
 	}
+	entityCount := countFiles(contentDir, ".md")
 
-	graph2mdArgs := []string{
-		"-input", graphPath,
-		"-output", contentDir,
+	entities, err := loadEntities(contentDir)
+	if err != nil {
+		fatal("Failed to read generated content: %v", err)
 	}
-	if repoName != "" {
-		graph2mdArgs = append(graph2mdArgs, "-repo", repoName)
+
+	// Step 7b: Attach CODEOWNERS ownership to file-backed entities
+	var codeOwners *CodeOwners
+	var ownerStats []*OwnerStats
+	if useCodeOwners {
+		codeOwners, err = findCodeOwners(workspaceDir)
+		if err != nil {
+			fatal("Failed to read CODEOWNERS: %v", err)
+		}
 	}
-	if repoURL != "" {
-		graph2mdArgs = append(graph2mdArgs, "-repo-url", repoURL)
+	if codeOwners != nil {
+		logGroup("codeowners", "Attaching code owners")
+		fmt.Printf("Using %s (%d rules)\n", codeOwners.Path, len(codeOwners.Rules))
+		ownerStats, err = attachOwners(entities, codeOwners)
+		if err != nil {
+			fatal("Failed to attach owners: %v", err)
+		}
+		for _, s := range ownerStats {
+			fmt.Printf("%s: %d files, %d entities\n", s.Owner, len(s.Files), s.Entities)
+		}
+		logGroupEnd()
 	}
 
-	if err := runCommand("graph2md", graph2mdArgs...); err != nil {
-		fatal("graph2md failed: %v", err)
+	// Step 7c: Attach git history (churn, last-modified, contributors)
+	var history *RepoHistory
+	var hotspots []Hotspot
+	if useGitHistory {
+		logGroup("history", "Reading git history")
+		history, err = readGitHistory(runCtx, workspaceDir)
+		if err != nil {
+			fatal("Failed to read git history: %v", err)
+		}
+		if history == nil {
+			fmt.Println("Workspace is not a git checkout, skipping history")
+		} else {
+			if history.Shallow {
+				fmt.Println("::warning::Repository is a shallow clone; history metrics only cover fetched commits. Use actions/checkout with fetch-depth: 0 for full history.")
+			}
+			hotspots, err = attachHistory(entities, history, workspaceDir)
+			if err != nil {
+				fatal("Failed to attach history: %v", err)
+			}
+			fmt.Printf("History for %d files, %d hotspots\n", len(history.Files), len(hotspots))
+		}
+		logGroupEnd()
 	}
 
-	entityCount := countFiles(contentDir, ".md")
-	fmt.Printf("Generated %d markdown files\n", entityCount)
-	logGroupEnd()
+	// Step 8: Generate pssg.yaml and run pssg build. Rendering always runs;
+	// the site build is cheap next to the analysis.
+	if err := journal.start(resumeRender, commit); err != nil {
+		fatal("Failed to write journal: %v", err)
+	}
+	logGroup("build", "Building static site")
+	// Drop what a previous run in a persistent work dir left behind
+	for _, name := range []string{"templates", "site", "site-entities", "content-changed", "publish"} {
+		if err := os.RemoveAll(filepath.Join(workDir, name)); err != nil {
+			fatal("Failed to clear work dir: %v", err)
+		}
+	}
 
-	// Step 8: Generate pssg.yaml and run pssg build
-	logGroup("Building static site")
-
-	// Determine templates path
-	tplDir := templatesDir
-	if tplDir == "" {
-		// Use bundled templates
-		tplDir = "/app/templates"
-		// If running outside Docker (e.g., local testing), fall back
-		if _, err := os.Stat(tplDir); os.IsNotExist(err) {
-			// Try relative to binary
-			execPath, _ := os.Executable()
-			tplDir = filepath.Join(filepath.Dir(execPath), "templates")
-			if _, err := os.Stat(tplDir); os.IsNotExist(err) {
-				tplDir = "templates"
+	// Templates are the embedded defaults, overlaid with templates-dir
+	templateLayers := []fs.FS{bundledTemplates()}
+	if templatesDir != "" {
+		if !filepath.IsAbs(templatesDir) {
+			templatesDir = filepath.Join(workspaceDir, templatesDir)
+		}
+		templateLayers = append(templateLayers, os.DirFS(templatesDir))
+		ejected, err := readTemplatesMarker(templatesDir)
+		if err != nil {
+			fatal("Failed to read templates marker: %v", err)
+		}
+		if ejected != nil {
+			bundled, err := templateSetMarker(bundledTemplates())
+			if err != nil {
+				fatal("Failed to hash bundled templates: %v", err)
+			}
+			// Only overridden files matter; the rest fall back to the defaults.
+			var changed []string
+			for _, c := range upstreamTemplateChanges(ejected, bundled) {
+				if _, err := os.Stat(filepath.Join(templatesDir, c.Name)); err == nil {
+					changed = append(changed, c.String())
+				}
+			}
+			if len(changed) > 0 {
+				fmt.Printf("::notice::Bundled templates changed since %s was ejected (version %s, now %s): %s\n",
+					templatesDir, ejected.Version, bundled.Version, strings.Join(changed, ", "))
 			}
 		}
-	} else if !filepath.IsAbs(tplDir) {
-		tplDir = filepath.Join(workspaceDir, tplDir)
 	}
 
-	configPath := filepath.Join(tmpDir, "pssg.yaml")
-	if err := generateConfig(configPath, siteName, baseURL, repoURL, repoName, contentDir, tplDir, outputDir, workspaceDir); err != nil {
+	// Templates are staged into workDir so generated partials can be added
+	tplDir := filepath.Join(workDir, "templates")
+	for _, layer := range templateLayers {
+		if err := stageTemplates(layer, tplDir); err != nil {
+			fatal("Failed to stage templates: %v", err)
+		}
+	}
+	if assetsMode == assetsSelfHost {
+		leftover, err := selfHostTemplates(tplDir)
+		if err != nil {
+			fatal("Failed to rewrite template assets: %v", err)
+		}
+		for _, ref := range leftover {
+			fmt.Printf("::warning::Template still loads a third-party asset: %s\n", ref)
+		}
+	}
+
+	if configOverlay != "" && !filepath.IsAbs(configOverlay) {
+		configOverlay = filepath.Join(workspaceDir, configOverlay)
+	}
+
+	configPath := filepath.Join(workDir, "pssg.yaml")
+	baseCfg := newPSSGConfig(siteName, siteBaseURL, repoURL, repoName, contentDir, tplDir, siteDir, workspaceDir)
+	if taxonomyList != "" {
+		baseCfg.Taxonomies = selectTaxonomies(taxonomyList)
+	} else if codeOwners != nil {
+		baseCfg.Taxonomies = append(baseCfg.Taxonomies, ownersTaxonomy)
+	}
+	if private {
+		applyPrivateMode(baseCfg)
+	}
+	cfg, err := generateConfig(configPath, baseCfg, configOverlay)
+	if err != nil {
 		fatal("Failed to generate pssg config: %v", err)
 	}
+	if err := validateTheme(cfg.Extra.Theme, workspaceDir); err != nil {
+		fatal("Invalid theme: %v", err)
+	}
+	partials := GeneratedPartials{RootPrefix: rootPrefix, Version: version, NoIndex: private, ThemeDir: workspaceDir, DataExport: dataMode}
+	if history != nil {
+		partials.ExtraLinks = append(partials.ExtraLinks, NavLink{Href: "/hotspots.html", Label: "Hotspots"})
+	}
+	if err := writeGeneratedPartials(tplDir, cfg, partials); err != nil {
+		fatal("Failed to generate template partials: %v", err)
+	}
 
-	if err := runCommand("pssg", "build", "--config", configPath); err != nil {
-		fatal("pssg build failed: %v", err)
+	pathPrefix := extractPathPrefix(siteBaseURL)
+
+	// In incremental mode, unchanged entity pages are kept from the previous
+	// build in siteDir. Changed entity pages and the aggregate pages (hubs,
+	// taxonomies, search, sitemap) are built into temp dirs and merged in.
+	var plan *IncrementalPlan
+	buildDir := siteDir
+	entityBuildDir := ""
+	if incremental {
+		plan, err = planIncrementalBuild(siteDir, entities, tplDir, cfg, configOverlay, workspaceDir, pathPrefix)
+		if err != nil {
+			fatal("Failed to plan incremental build: %v", err)
+		}
+		if plan.Full {
+			fmt.Printf("Full build: %s\n", plan.Reason)
+		} else {
+			fmt.Printf("Incremental build: %d changed, %d removed entities\n", len(plan.Changed), len(plan.Removed))
+		}
 	}
 
-	pageCount := countFiles(outputDir, ".html")
-	fmt.Printf("Built %d HTML pages\n", pageCount)
+	upToDate := plan != nil && !plan.Full && len(plan.Changed) == 0 && len(plan.Removed) == 0
+	switch {
+	case upToDate:
+		fmt.Println("Site is up to date, skipping pssg build")
+	case plan != nil && !plan.Full:
+		buildDir = filepath.Join(workDir, "site")
+		entityBuildDir = filepath.Join(workDir, "site-entities")
+		changedDir := filepath.Join(workDir, "content-changed")
+		if err := writeChangedContent(changedDir, entities, plan.Changed); err != nil {
+			fatal("Failed to stage changed content: %v", err)
+		}
+		if err := writeEntityStub(tplDir); err != nil {
+			fatal("Failed to write entity stub template: %v", err)
+		}
+
+		entityConfigPath := filepath.Join(workDir, "pssg-entities.yaml")
+		if _, err := generateConfig(entityConfigPath, baseCfg, configOverlay, map[string]interface{}{
+			"paths": map[string]interface{}{"data": changedDir, "output": entityBuildDir},
+		}); err != nil {
+			fatal("Failed to generate pssg config: %v", err)
+		}
+		if err := runPSSG(runCtx, entityConfigPath); err != nil {
+			fatal("pssg build failed: %v", err)
+		}
+
+		aggregateConfigPath := filepath.Join(workDir, "pssg-aggregate.yaml")
+		if _, err := generateConfig(aggregateConfigPath, baseCfg, configOverlay, map[string]interface{}{
+			"paths":     map[string]interface{}{"output": buildDir},
+			"templates": map[string]interface{}{"entity": entityStubTemplate},
+		}); err != nil {
+			fatal("Failed to generate pssg config: %v", err)
+		}
+		if err := runPSSG(runCtx, aggregateConfigPath); err != nil {
+			fatal("pssg build failed: %v", err)
+		}
+	default:
+		if err := runPSSG(runCtx, configPath); err != nil {
+			fatal("pssg build failed: %v", err)
+		}
+	}
+
+	if !upToDate {
+		if err := writeThemeAssets(cfg.Extra.Theme, workspaceDir, buildDir); err != nil {
+			fatal("Failed to write theme assets: %v", err)
+		}
+		if cfg.Search.Enabled {
+			search, err := writeSearchShards(buildDir)
+			if err != nil {
+				fatal("Failed to shard search index: %v", err)
+			}
+			if search != nil {
+				fmt.Printf("Search index: %d entries in %d shards\n", search.Docs, len(search.Shards))
+				report.addMetric("search_entries", int64(search.Docs))
+			}
+		}
+		if assetsMode == assetsSelfHost {
+			if err := writeVendorAssets(buildDir); err != nil {
+				fatal("Failed to write self-hosted assets: %v", err)
+			}
+		}
+		if history != nil {
+			if err := writeHotspotsPage(tplDir, buildDir, siteInfo(cfg), hotspots); err != nil {
+				fatal("Failed to write hotspots page: %v", err)
+			}
+			lastmod := map[string]string{}
+			for _, e := range entities {
+				if d := e.GetString("last_modified"); d != "" {
+					lastmod[entitySlug(e)] = d
+				}
+			}
+			if err := applySitemapLastmod(buildDir, cfg.Site.BaseURL, lastmod); err != nil {
+				fatal("Failed to update sitemap dates: %v", err)
+			}
+		}
+
+		if codeOwners != nil {
+			if err := writeOwnershipReport(filepath.Join(buildDir, "ownership.json"), codeOwners.Path, ownerStats); err != nil {
+				fatal("Failed to write ownership report: %v", err)
+			}
+		}
+	}
 	logGroupEnd()
 
 	// Step 8b: Rewrite paths if base URL has a path prefix (e.g. GitHub Pages subdirectory)
-	pathPrefix := extractPathPrefix(baseURL)
-	if pathPrefix != "" {
-		logGroup("Rewriting paths for subdirectory deployment")
+	if pathPrefix != "" && !upToDate {
+		logGroup("rewrite", "Rewriting paths for subdirectory deployment")
 		fmt.Printf("Path prefix: %s\n", pathPrefix)
-		if err := rewritePathPrefix(outputDir, pathPrefix); err != nil {
-			fatal("Failed to rewrite paths: %v", err)
+		for _, dir := range []string{buildDir, entityBuildDir} {
+			if dir == "" {
+				continue
+			}
+			if err := rewritePathPrefix(dir, pathPrefix); err != nil {
+				fatal("Failed to rewrite paths: %v", err)
+			}
 		}
 		logGroupEnd()
 	}
 
+	if plan != nil {
+		if !plan.Full && !upToDate {
+			logGroup("merge", "Merging incremental build")
+			written, deleted, err := mergeIncrementalBuild(siteDir, entityBuildDir, buildDir, plan)
+			if err != nil {
+				fatal("Failed to merge incremental build: %v", err)
+			}
+			fmt.Printf("%d files written, %d deleted\n", written, deleted)
+			logGroupEnd()
+		}
+		if err := writeBuildManifest(siteDir, plan.Manifest); err != nil {
+			fatal("Failed to write build manifest: %v", err)
+		}
+	}
+
+	// Step 8c: Export the graph and content the site was built from. This
+	// runs after the path rewrite, which must not touch the raw data.
+	if dataMode != dataOff {
+		logGroup("data", "Exporting site data")
+		meta := &SiteMetadata{
+			Generator:       "arch-docs",
+			ArchDocsVersion: report.ArchDocsVersion,
+			SiteName:        siteName,
+			BaseURL:         siteBaseURL,
+			Repository:      ghRepo,
+			RepositoryURL:   repoURL,
+			Commit:          commit,
+			ArchiveDigest:   archiveSHA,
+			Version:         version,
+			GeneratedAt:     time.Now().UTC(),
+			SchemaVersion:   graph.SchemaVersion,
+			Counts: map[string]int{
+				"entities":      entityCount,
+				"nodes":         len(graph.Graph.Nodes),
+				"relationships": len(graph.Graph.Relationships),
+				"domains":       len(graph.Domains),
+			},
+		}
+		if err := writeDataExport(siteDir, dataMode, graphJSON, contentDir, meta); err != nil {
+			fatal("Failed to export site data: %v", err)
+		}
+		if cfg.LLMsTxt.Enabled {
+			if err := appendLLMsData(siteDir, meta); err != nil {
+				fatal("Failed to update llms.txt: %v", err)
+			}
+		}
+		for _, f := range meta.Files {
+			fmt.Printf("%s (%.2f MB)\n", f.URL, float64(f.Bytes)/(1024*1024))
+			report.addMetric("bytes", f.Bytes)
+		}
+		logGroupEnd()
+	}
+
+	pageCount := countFiles(siteDir, ".html")
+	fmt.Printf("Site has %d HTML pages\n", pageCount)
+
+	// Step 8d: Update the versions manifest and root redirect
+	if version != "" {
+		logGroup("versions", "Updating versions manifest")
+		manifest, err := readVersionManifest(outputDir)
+		if err != nil {
+			fatal("Failed to read versions manifest: %v", err)
+		}
+		manifest.addVersion(version, rootPrefix, time.Now())
+		if err := writeVersionRoot(outputDir, baseURL, rootPrefix, manifest); err != nil {
+			fatal("Failed to write versions manifest: %v", err)
+		}
+		fmt.Printf("%d versions, latest: %s\n", len(manifest.Versions), manifest.Latest)
+		logGroupEnd()
+	}
+
+	// Private sites keep crawlers out of the whole output root
+	if private {
+		if err := os.WriteFile(filepath.Join(outputDir, "robots.txt"), []byte(privateRobotsTxt), 0644); err != nil {
+			fatal("Failed to write robots.txt: %v", err)
+		}
+	}
+
+	// Step 8e: Check that internal links resolve
+	brokenLinks := 0
+	if linkCheckMode != linkCheckOff {
+		logGroup("link-check", "Checking internal links")
+		links, err := checkLinks(siteDir, siteBaseURL)
+		if err != nil {
+			fatal("Failed to check links: %v", err)
+		}
+		printLinkReport(links, linkCheckMode)
+		brokenLinks = links.Broken
+		report.addMetric("links_checked", int64(links.Checked))
+		report.addMetric("broken_links", int64(links.Broken))
+		logGroupEnd()
+		if brokenLinks > 0 && linkCheckMode == linkCheckFail {
+			fatal("%d broken internal links", brokenLinks)
+		}
+	}
+
+	if err := journal.complete(resumeRender); err != nil {
+		fatal("Failed to write journal: %v", err)
+	}
+
 	// Step 9: Set outputs
-	logGroup("Setting outputs")
+	logGroup("outputs", "Setting outputs")
 	absOutput, _ := filepath.Abs(outputDir)
 	setOutput("site-path", absOutput)
 	setOutput("entity-count", strconv.Itoa(entityCount))
 	setOutput("page-count", strconv.Itoa(pageCount))
+	setOutput("run-report", reportPath)
+	if archiveSHA != "" {
+		setOutput("archive-digest", archiveSHA)
+	}
+	report.setRunMetric("entities", int64(entityCount))
+	report.setRunMetric("pages", int64(pageCount))
+	report.setRunMetric("output_bytes", dirSize(outputDir))
+	if linkCheckMode != linkCheckOff {
+		setOutput("broken-links", strconv.Itoa(brokenLinks))
+	}
+	if version != "" {
+		setOutput("version", version)
+	}
 	fmt.Printf("site-path=%s\n", absOutput)
 	fmt.Printf("entity-count=%d\n", entityCount)
 	fmt.Printf("page-count=%d\n", pageCount)
 	logGroupEnd()
 
+	// Step 10: Deploy to S3-compatible storage and/or a Pages branch
+	if s3Target != nil {
+		logGroup("s3", "Deploying to S3")
+		fmt.Printf("Syncing %s to s3://%s/%s\n", outputDir, s3Target.Bucket, s3Target.Prefix)
+		res, err := syncToS3(runCtx, outputDir, *s3Target)
+		if err != nil {
+			fatal("S3 deploy failed: %v", err)
+		}
+		fmt.Printf("%d uploaded, %d unchanged, %d deleted\n", res.Uploaded, res.Unchanged, res.Deleted)
+		report.addMetric("uploaded", int64(res.Uploaded))
+		report.addMetric("unchanged", int64(res.Unchanged))
+		report.addMetric("deleted", int64(res.Deleted))
+		logGroupEnd()
+	}
+
+	if publishBranch != "" {
+		logGroup("publish", "Publishing to "+publishBranch)
+		serverURL := os.Getenv("GITHUB_SERVER_URL")
+		if serverURL == "" {
+			serverURL = "https://github.com"
+		}
+		message := "Update architecture docs"
+		if sha := os.Getenv("GITHUB_SHA"); len(sha) >= 7 {
+			message += " for " + sha[:7]
+		}
+		var keep []string
+		for _, p := range strings.Split(getInput("publish-keep"), ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				keep = append(keep, p)
+			}
+		}
+		publishDir := filepath.Join(workDir, "publish")
+		atExit(func() { os.RemoveAll(publishDir) })
+		pushed, err := publishToBranch(runCtx, outputDir, publishDir, PublishOptions{
+			Remote:       strings.TrimRight(serverURL, "/") + "/" + ghRepo + ".git",
+			Branch:       publishBranch,
+			Token:        getInput("github-token"),
+			Keep:         keep,
+			KeepVersions: getBoolInput("publish-keep-versions", true),
+			BaseURL:      baseURL,
+			PathPrefix:   rootPrefix,
+			Message:      message,
+		})
+		// The clone holds the token in its config; don't keep it in work-dir
+		os.RemoveAll(publishDir)
+		if err != nil {
+			fatal("Publishing to %s failed: %v", publishBranch, err)
+		}
+		if pushed {
+			fmt.Printf("Pushed to %s\n", publishBranch)
+		} else {
+			fmt.Printf("%s is already up to date\n", publishBranch)
+		}
+		logGroupEnd()
+	}
+
 	fmt.Println("Architecture docs generated successfully!")
+	runCleanups()
+	if err := report.finish(runSucceeded, ""); err != nil {
+		fmt.Printf("::warning::Failed to write run report: %v\n", err)
+	}
+	flushLog()
 }
 
 // getInput reads a GitHub Actions input from the environment.
@@ -427,6 +896,17 @@ func getInput(name string) string {
 	return strings.TrimSpace(val)
 }
 
+// getBoolInput reads a boolean GitHub Actions input, returning def if unset.
+func getBoolInput(name string, def bool) bool {
+	switch strings.ToLower(getInput(name)) {
+	case "true", "yes", "1":
+		return true
+	case "false", "no", "0":
+		return false
+	}
+	return def
+}
+
 // setOutput writes a GitHub Actions output value.
 func setOutput(name, value string) {
 	outputFile := os.Getenv("GITHUB_OUTPUT")
@@ -443,140 +923,52 @@ func setOutput(name, value string) {
 	fmt.Fprintf(f, "%s=%s\n", name, value)
 }
 
-// logGroup starts a GitHub Actions log group.
-func logGroup(name string) {
-	fmt.Printf("::group::%s\n", name)
+// logGroup starts a GitHub Actions log group and times it as stage in the
+// run report. A cancelled run stops here rather than start the stage.
+func logGroup(stage, title string) {
+	if runCtx.Err() != nil {
+		fatal("Cancelled before %s", stage)
+	}
+	if logFormat == logFormatText {
+		fmt.Printf("::group::%s\n", title)
+	}
+	report.beginStage(stage)
 }
 
-// logGroupEnd ends a GitHub Actions log group.
+// logGroupEnd ends a GitHub Actions log group and its stage.
 func logGroupEnd() {
-	fmt.Println("::endgroup::")
+	report.endStage()
+	if logFormat == logFormatText {
+		fmt.Println("::endgroup::")
+	}
 }
 
-// fatal prints an error and exits.
+// fatal prints an error, removes temporary files, writes the run report and
+// exits. Errors of a cancelled run are caused by the cancellation, so it
+// exits with exitCancelled instead of 1.
 func fatal(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
+	status, code := runFailed, 1
+	if runCtx.Err() != nil {
+		status, code = runCancelled, exitCancelled
+	}
 	fmt.Printf("::error::%s\n", msg)
-	os.Exit(1)
-}
-
-// createRepoZip walks the workspace directory and creates a zip archive.
-// It skips .git/, node_modules/, binary files, and files > 10MB.
-func createRepoZip(workspaceDir string) (string, error) {
-	tmpFile, err := os.CreateTemp("", "repo-*.zip")
-	if err != nil {
-		return "", fmt.Errorf("creating temp file: %w", err)
-	}
-	defer tmpFile.Close()
-
-	zw := zip.NewWriter(tmpFile)
-	defer zw.Close()
-
-	skipDirs := map[string]bool{
-		".git":         true,
-		"node_modules": true,
-		".next":        true,
-		"dist":         true,
-		"build":        true,
-		"vendor":       true,
-		"__pycache__":  true,
-		".venv":        true,
-	}
-
-	binaryExts := map[string]bool{
-		".exe": true, ".dll": true, ".so": true, ".dylib": true,
-		".bin": true, ".obj": true, ".o": true, ".a": true,
-		".png": true, ".jpg": true, ".jpeg": true, ".gif": true,
-		".ico": true, ".svg": true, ".webp": true,
-		".mp3": true, ".mp4": true, ".avi": true, ".mov": true,
-		".zip": true, ".tar": true, ".gz": true, ".bz2": true,
-		".rar": true, ".7z": true,
-		".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
-		".pdf": true, ".doc": true, ".docx": true,
-	}
-
-	fileCount := 0
-	err = filepath.Walk(workspaceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // skip errors
-		}
-
-		relPath, err := filepath.Rel(workspaceDir, path)
-		if err != nil {
-			return nil
-		}
-
-		// Skip root
-		if relPath == "." {
-			return nil
-		}
-
-		// Skip hidden dirs and known large dirs
-		baseName := filepath.Base(path)
-		if info.IsDir() {
-			if skipDirs[baseName] || strings.HasPrefix(baseName, ".") {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// Skip binary files
-		ext := strings.ToLower(filepath.Ext(path))
-		if binaryExts[ext] {
-			return nil
-		}
-
-		// Skip files > 10MB
-		if info.Size() > maxFileSize {
-			return nil
-		}
-
-		// Skip hidden files
-		if strings.HasPrefix(baseName, ".") {
-			return nil
-		}
-
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return nil
-		}
-		header.Name = relPath
-		header.Method = zip.Deflate
-
-		writer, err := zw.CreateHeader(header)
-		if err != nil {
-			return nil
-		}
-
-		file, err := os.Open(path)
-		if err != nil {
-			return nil
-		}
-		defer file.Close()
-
-		_, err = io.Copy(writer, file)
-		if err != nil {
-			return nil
-		}
-
-		fileCount++
-		return nil
-	})
-
-	if err != nil {
-		return "", fmt.Errorf("walking workspace: %w", err)
+	runCleanups()
+	if err := report.finish(status, msg); err != nil {
+		fmt.Printf("::warning::Failed to write run report: %v\n", err)
 	}
-
-	fmt.Printf("Archived %d files\n", fileCount)
-	return tmpFile.Name(), nil
+	flushLog()
+	os.Exit(code)
 }
 
-// callSupermodelAPI sends the zip to the Supermodel API and polls for completion.
-func callSupermodelAPI(apiKey, zipPath string) ([]byte, error) {
-	idempotencyKey := generateUUID()
-
+// callSupermodelAPI sends the zip to the Supermodel API and polls for
+// completion until ctx is cancelled. idempotencyKey is the archive digest,
+// so the API recognises a repeated submission of the same files.
+func callSupermodelAPI(ctx context.Context, apiKey, zipPath, idempotencyKey string) ([]byte, error) {
 	// Initial POST
-	respBody, resp, err := postWithZip(apiKey, zipPath, idempotencyKey)
+	report.beginStage("upload")
+	respBody, resp, err := postWithZip(ctx, apiKey, zipPath, idempotencyKey)
+	report.endStage()
 	if err != nil {
 		return nil, fmt.Errorf("initial request: %w", err)
 	}
@@ -595,14 +987,25 @@ func callSupermodelAPI(apiKey, zipPath string) ([]byte, error) {
 	}
 
 	// Poll loop
+	report.beginStage("poll")
+	defer report.endStage()
 	deadline := time.Now().Add(pollTimeout)
 	for time.Now().Before(deadline) {
 		interval := getPollInterval(resp, defaultPollInterval)
 		fmt.Printf("Status: %s (job: %s), polling in %s...\n", apiResp.Status, apiResp.JobID, interval)
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
 
-		respBody, resp, err = postWithZip(apiKey, zipPath, idempotencyKey)
+		report.addMetric("attempts", 1)
+		respBody, resp, err = postWithZip(ctx, apiKey, zipPath, idempotencyKey)
+		if err != nil && ctx.Err() != nil {
+			continue // stops at the select above
+		}
 		if err != nil {
+			report.addMetric("failed_attempts", 1)
 			fmt.Printf("::warning::Poll request failed: %v, retrying...\n", err)
 			continue
 		}
@@ -624,13 +1027,14 @@ func callSupermodelAPI(apiKey, zipPath string) ([]byte, error) {
 }
 
 // postWithZip sends a multipart POST request with the zip file.
-func postWithZip(apiKey, zipPath, idempotencyKey string) ([]byte, *http.Response, error) {
+func postWithZip(ctx context.Context, apiKey, zipPath, idempotencyKey string) ([]byte, *http.Response, error) {
 	body, contentType, err := createMultipartBody(zipPath)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	req, err := http.NewRequest("POST", apiBaseURL, body)
+	report.addMetric("bytes_sent", int64(body.Len()))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiBaseURL, body)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -651,6 +1055,7 @@ func postWithZip(apiKey, zipPath, idempotencyKey string) ([]byte, *http.Response
 		return nil, nil, fmt.Errorf("reading response: %w", err)
 	}
 
+	report.addMetric("bytes_received", int64(len(respBody)))
 	if resp.StatusCode >= 400 {
 		return nil, nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
 	}
@@ -685,16 +1090,6 @@ func createMultipartBody(zipPath string) (*bytes.Buffer, string, error) {
 	return body, writer.FormDataContentType(), nil
 }
 
-// generateUUID generates a UUID v4.
-func generateUUID() string {
-	b := make([]byte, 16)
-	_, _ = rand.Read(b)
-	b[6] = (b[6] & 0x0f) | 0x40 // version 4
-	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
-	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
-		b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
-}
-
 // getPollInterval reads the Retry-After header or returns the default.
 func getPollInterval(resp *http.Response, defaultInterval time.Duration) time.Duration {
 	if resp == nil {
@@ -717,31 +1112,41 @@ func getPollInterval(resp *http.Response, defaultInterval time.Duration) time.Du
 	return time.Duration(seconds) * time.Second
 }
 
-// generateConfig writes a pssg.yaml config file.
-func generateConfig(configPath, siteName, baseURL, repoURL, repoName, contentDir, tplDir, outputDir, sourceDir string) error {
-	config := fmt.Sprintf(pssgConfigTemplate,
-		siteName,       // site.name
-		baseURL,        // site.base_url
-		repoURL,        // site.repo_url
-		repoName,       // site.description
-		contentDir,     // paths.data
-		tplDir,         // paths.templates
-		outputDir,      // paths.output
-		sourceDir,      // paths.source_dir
-		siteName,       // rss.title
-		repoName,       // rss.description
-		siteName,       // llms_txt.title
-		repoName,       // llms_txt.description
-	)
-	return os.WriteFile(configPath, []byte(config), 0644)
+// generateConfig writes a pssg.yaml config file, merging the optional user
+// overlay and any overrides on top of the generated defaults. It returns the
+// merged config.
+func generateConfig(configPath string, cfg *PSSGConfig, overlayPath string, overrides ...map[string]interface{}) (*PSSGConfig, error) {
+	data, err := renderConfig(cfg, overlayPath, overrides...)
+	if err != nil {
+		return nil, err
+	}
+	var merged PSSGConfig
+	if err := yaml.Unmarshal(data, &merged); err != nil {
+		return nil, fmt.Errorf("reading merged config: %w", err)
+	}
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// runPSSG runs pssg build with a config, timed as a nested stage.
+func runPSSG(ctx context.Context, configPath string) error {
+	report.beginStage("pssg")
+	defer report.endStage()
+	return runCommand(ctx, "pssg", "build", "--config", configPath)
 }
 
 // runCommand executes an external command with stdout/stderr forwarding.
-func runCommand(name string, args ...string) error {
+// When ctx is cancelled the command gets SIGTERM, and is killed if it hasn't
+// exited after commandStopGrace.
+func runCommand(ctx context.Context, name string, args ...string) error {
 	fmt.Printf("Running: %s %s\n", name, strings.Join(args, " "))
-	cmd := exec.Command(name, args...)
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = commandStopGrace
 	return cmd.Run()
 }
 
@@ -759,51 +1164,6 @@ func extractPathPrefix(baseURL string) string {
 	return p
 }
 
-// rewritePathPrefix rewrites all root-relative paths in HTML and JS files to
-// include the given prefix. This is needed when deploying to a subdirectory
-// (e.g. GitHub Pages project sites at username.github.io/repo/).
-func rewritePathPrefix(dir, prefix string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if info.IsDir() {
-			return nil
-		}
-
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".html" && ext != ".js" {
-			return nil
-		}
-
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return nil
-		}
-
-		content := string(data)
-		original := content
-
-		// Rewrite href="/..." to href="/prefix/..."
-		content = strings.ReplaceAll(content, `href="/`, `href="`+prefix+`/`)
-		// Rewrite src="/..." to src="/prefix/..."
-		content = strings.ReplaceAll(content, `src="/`, `src="`+prefix+`/`)
-		// Rewrite fetch("/..." to fetch("/prefix/..."
-		content = strings.ReplaceAll(content, `fetch("/`, `fetch("`+prefix+`/`)
-		// Rewrite JS navigation: window.location.href = "/" + ...
-		content = strings.ReplaceAll(content, `window.location.href = "/"`, `window.location.href = "`+prefix+`/"`)
-		content = strings.ReplaceAll(content, `window.location.href = "/" + `, `window.location.href = "`+prefix+`/" + `)
-
-		if content != original {
-			if err := os.WriteFile(path, []byte(content), info.Mode()); err != nil {
-				return fmt.Errorf("writing %s: %w", path, err)
-			}
-		}
-
-		return nil
-	})
-}
-
 // fetchOrgCNAME fetches the raw CNAME file from the org's .github.io repo.
 // Returns the custom domain string or "" if not found.
 func fetchOrgCNAME(org string) string {
@@ -821,6 +1181,18 @@ func fetchOrgCNAME(org string) string {
 	return strings.TrimSpace(string(body))
 }
 
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
 // countFiles counts files with the given extension in a directory tree.
 func countFiles(dir, ext string) int {
 	count := 0
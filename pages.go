@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sitePageLayout wraps arch-docs generated report pages in the site chrome
+// from the staged template partials, so they match pages built by pssg.
+const sitePageLayout = `<!DOCTYPE html>
+<html lang="en">
+<head>
+{{template "_head.html" .}}
+<title>{{.Title}} | {{.Site.Name}}</title>
+<meta name="description" content="{{.Description}}">
+<link rel="canonical" href="{{.Site.BaseURL}}/{{.Path}}">
+<style>{{template "_styles.css"}}</style>
+</head>
+<body>
+{{template "_header.html" .}}
+
+<main id="main-content">
+  <div class="container">
+    <div class="hub-header">
+      <div class="entity-breadcrumb">
+        <a href="/">Home</a>
+        <span class="sep">/</span>
+        <span>{{.Title}}</span>
+      </div>
+      <h1>{{.Title}}</h1>
+      <p class="hub-desc">{{.Description}}</p>
+    </div>
+{{template "body" .Data}}
+  </div>
+</main>
+
+{{template "_footer.html"}}
+<script src="/main.js"></script>
+</body>
+</html>
+`
+
+// sitePagePartials are the partials the layout needs.
+var sitePagePartials = []string{"_head.html", "_meta.html", "_custom_head.html", "_header.html", "_nav.html", "_versions.html", "_footer.html", "_logo.html", "_favicon.html", "_styles.css", "_theme.css", "_custom.css"}
+
+// SiteInfo is the subset of pssg's .Site exposed to generated pages.
+type SiteInfo struct {
+	Name        string
+	BaseURL     string
+	RepoURL     string
+	Description string
+}
+
+// siteInfo returns the site metadata of a pssg config.
+func siteInfo(cfg *PSSGConfig) SiteInfo {
+	return SiteInfo{
+		Name:        cfg.Site.Name,
+		BaseURL:     cfg.Site.BaseURL,
+		RepoURL:     cfg.Site.RepoURL,
+		Description: cfg.Site.Description,
+	}
+}
+
+// sitePage is the data passed to sitePageLayout.
+type sitePage struct {
+	Site        SiteInfo
+	Title       string
+	Description string
+	Path        string
+	Data        interface{}
+}
+
+// pageFuncs stubs the pssg template functions partials commonly use, so
+// custom partials parse outside pssg.
+var pageFuncs = template.FuncMap{
+	"slug":         slugify,
+	"lower":        strings.ToLower,
+	"upper":        strings.ToUpper,
+	"safeHTML":     func(s string) template.HTML { return template.HTML(s) },
+	"safeJS":       func(s string) template.JS { return template.JS(s) },
+	"formatNumber": func(v interface{}) string { return fmt.Sprint(v) },
+	"sub":          func(a, b int) int { return a - b },
+	"add":          func(a, b int) int { return a + b },
+}
+
+// slugify lowercases s and joins its alphanumeric runs with hyphens, like
+// toSlug in _main.js.
+func slugify(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), "-")
+}
+
+// renderSitePage renders bodyTpl with data inside the site layout and writes
+// it to outputDir/relPath.
+func renderSitePage(tplDir, outputDir, relPath string, site SiteInfo, title, description, bodyTpl string, data interface{}) error {
+	t := template.New("page").Funcs(pageFuncs)
+	for _, name := range sitePagePartials {
+		src, err := os.ReadFile(filepath.Join(tplDir, name))
+		if os.IsNotExist(err) {
+			// Custom template sets may lack a partial; render it empty.
+			src = nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := t.New(name).Parse(string(src)); err != nil {
+			return fmt.Errorf("parsing %s: %w", name, err)
+		}
+	}
+	if _, err := t.New("body").Parse(bodyTpl); err != nil {
+		return fmt.Errorf("parsing page body: %w", err)
+	}
+	if _, err := t.Parse(sitePageLayout); err != nil {
+		return fmt.Errorf("parsing page layout: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err := t.ExecuteTemplate(&buf, "page", sitePage{
+		Site:        site,
+		Title:       title,
+		Description: description,
+		Path:        relPath,
+		Data:        data,
+	})
+	if err != nil {
+		return fmt.Errorf("rendering %s: %w", relPath, err)
+	}
+
+	outPath := filepath.Join(outputDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, buf.Bytes(), 0644)
+}
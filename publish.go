@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// publishAuthor is the identity publish commits are made with.
+const publishAuthor = "github-actions[bot]"
+const publishEmail = "41898282+github-actions[bot]@users.noreply.github.com"
+
+// PublishOptions configures publishing the site to a git branch.
+type PublishOptions struct {
+	Remote       string   // git remote URL
+	Branch       string   // target branch, created as an orphan if missing
+	Token        string   // sent as an HTTP auth header, never part of the URL
+	Keep         []string // glob patterns of branch files to keep, besides CNAME
+	KeepVersions bool     // keep version directories listed in the branch's versions.json
+	BaseURL      string   // root base URL, for rewriting the versions root
+	PathPrefix   string   // path prefix of BaseURL
+	Message      string
+}
+
+// publishToBranch commits the contents of siteDir on top of the target
+// branch, using workDir as a scratch checkout, and pushes it. Files on the
+// branch that the site doesn't contain are removed, except CNAME, files
+// matching opts.Keep and, with opts.KeepVersions, other version directories,
+// which are merged back into versions.json. It returns false if the branch
+// already had exactly this content. Cancelling ctx stops the git command in
+// progress.
+func publishToBranch(ctx context.Context, siteDir, workDir string, opts PublishOptions) (bool, error) {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return false, err
+	}
+	if _, err := gitRun(ctx, workDir, "init", "-q"); err != nil {
+		return false, err
+	}
+	if _, err := gitRun(ctx, workDir, "remote", "add", "origin", opts.Remote); err != nil {
+		return false, err
+	}
+	if opts.Token != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + opts.Token))
+		if _, err := gitRun(ctx, workDir, "config", "http.extraheader", "AUTHORIZATION: basic "+auth); err != nil {
+			return false, err
+		}
+	}
+
+	heads, err := gitRun(ctx, workDir, "ls-remote", "--heads", "origin", opts.Branch)
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(heads) != "" {
+		// Only the tip is needed to commit on top of it.
+		if _, err := gitRun(ctx, workDir, "fetch", "-q", "--depth=1", "origin", "refs/heads/"+opts.Branch); err != nil {
+			return false, err
+		}
+		if _, err := gitRun(ctx, workDir, "checkout", "-q", "-B", opts.Branch, "FETCH_HEAD"); err != nil {
+			return false, err
+		}
+	} else {
+		fmt.Printf("Branch %s does not exist yet, creating it\n", opts.Branch)
+		if _, err := gitRun(ctx, workDir, "checkout", "-q", "--orphan", opts.Branch); err != nil {
+			return false, err
+		}
+	}
+
+	kept, err := cleanPublishTree(siteDir, workDir, opts)
+	if err != nil {
+		return false, err
+	}
+
+	// The incremental build manifest is only needed by the next build.
+	err = filepath.Walk(siteDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == buildManifestName {
+			return err
+		}
+		rel, _ := filepath.Rel(siteDir, p)
+		return copyFile(p, filepath.Join(workDir, rel))
+	})
+	if err != nil {
+		return false, err
+	}
+	// Without .nojekyll, GitHub Pages skips files and directories starting
+	// with an underscore.
+	if err := os.WriteFile(filepath.Join(workDir, ".nojekyll"), nil, 0644); err != nil {
+		return false, err
+	}
+	if kept != nil {
+		if err := mergeKeptVersions(siteDir, workDir, kept, opts); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := gitRun(ctx, workDir, "add", "-A"); err != nil {
+		return false, err
+	}
+	if _, err := gitRun(ctx, workDir, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+	if _, err := gitRun(ctx, workDir, "config", "user.name", publishAuthor); err != nil {
+		return false, err
+	}
+	if _, err := gitRun(ctx, workDir, "config", "user.email", publishEmail); err != nil {
+		return false, err
+	}
+	if _, err := gitRun(ctx, workDir, "commit", "-q", "-m", opts.Message); err != nil {
+		return false, err
+	}
+	if _, err := gitRun(ctx, workDir, "push", "-q", "origin", "HEAD:refs/heads/"+opts.Branch); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// cleanPublishTree removes every file of the checked-out branch that should
+// not survive the publish. It returns the branch's versions manifest
+// restricted to the version directories that were kept, or nil if none were.
+func cleanPublishTree(siteDir, workDir string, opts PublishOptions) (*VersionManifest, error) {
+	keepDirs := map[string]bool{}
+	var kept *VersionManifest
+	// Other versions are only kept when this build is itself versioned.
+	_, err := os.Stat(filepath.Join(siteDir, versionsManifest))
+	if opts.KeepVersions && err == nil {
+		branch, err := readVersionManifest(workDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range branch.Versions {
+			if _, err := os.Stat(filepath.Join(siteDir, v.Name)); err == nil {
+				continue // rebuilt by this run
+			}
+			if info, err := os.Stat(filepath.Join(workDir, v.Name)); err == nil && info.IsDir() {
+				keepDirs[v.Name] = true
+				if kept == nil {
+					kept = &VersionManifest{}
+				}
+				kept.Versions = append(kept.Versions, v)
+			}
+		}
+	}
+
+	keep := func(rel string) bool {
+		if rel == "CNAME" || keepDirs[strings.SplitN(rel, "/", 2)[0]] {
+			return true
+		}
+		for _, pattern := range opts.Keep {
+			if ok, _ := path.Match(pattern, rel); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, strings.SplitN(rel, "/", 2)[0]); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var dirs []string
+	err = filepath.Walk(workDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(workDir, p)
+		rel = filepath.ToSlash(rel)
+		if rel == ".git" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() {
+			if rel != "." {
+				dirs = append(dirs, p)
+			}
+			return nil
+		}
+		if keep(rel) {
+			return nil
+		}
+		return os.Remove(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Remove directories left empty, deepest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		os.Remove(d) // fails for non-empty directories, which is intended
+	}
+	return kept, nil
+}
+
+// mergeKeptVersions adds the kept version directories to the new
+// versions.json and rewrites the root redirect accordingly.
+func mergeKeptVersions(siteDir, workDir string, kept *VersionManifest, opts PublishOptions) error {
+	m, err := readVersionManifest(siteDir)
+	if err != nil {
+		return err
+	}
+	m.mergeVersions(kept)
+	fmt.Printf("Kept %d versions from the branch, latest: %s\n", len(kept.Versions), m.Latest)
+	return writeVersionRoot(workDir, opts.BaseURL, opts.PathPrefix, m)
+}
+
+// gitRun runs git in dir and returns its stdout. Arguments are not echoed,
+// since they may carry credentials. Like runCommand, git gets SIGTERM when
+// ctx is cancelled and is killed if it doesn't exit in time.
+func gitRun(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = commandStopGrace
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
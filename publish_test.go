@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitTest runs git in dir, failing the test on error.
+func gitTest(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// versionedSite builds a site directory holding a single version, with
+// versions.json and the root redirect.
+func versionedSite(t *testing.T, version string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		version + "/index.html":           "<h1>" + version + "</h1>",
+		version + "/_assets/style.css":    "body{}",
+		version + "/" + buildManifestName: "{}",
+	})
+	m := &VersionManifest{}
+	m.addVersion(version, "/repo", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := writeVersionRoot(dir, "https://example.github.io/repo", "/repo", m); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// branchFiles lists the files on branch of the bare repository.
+func branchFiles(t *testing.T, bare, branch string) []string {
+	t.Helper()
+	out := gitTest(t, bare, "ls-tree", "-r", "--name-only", branch)
+	files := strings.Fields(out)
+	sort.Strings(files)
+	return files
+}
+
+func TestPublishToBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	bare := filepath.Join(t.TempDir(), "remote.git")
+	gitTest(t, t.TempDir(), "init", "-q", "--bare", bare)
+	opts := PublishOptions{
+		Remote:       bare,
+		Branch:       "gh-pages",
+		Keep:         []string{"keep-*.txt", "preview"},
+		KeepVersions: true,
+		BaseURL:      "https://example.github.io/repo",
+		PathPrefix:   "/repo",
+		Message:      "Update docs",
+	}
+	publish := func(site string) bool {
+		t.Helper()
+		pushed, err := publishToBranch(context.Background(), site, filepath.Join(t.TempDir(), "publish"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pushed
+	}
+
+	// The first publish creates the branch
+	if !publish(versionedSite(t, "v1.0.0")) {
+		t.Fatal("first publish pushed nothing")
+	}
+
+	// Files added to the branch by hand
+	clone := t.TempDir()
+	gitTest(t, clone, "clone", "-q", "--branch", "gh-pages", bare, ".")
+	writeTestFiles(t, clone, map[string]string{
+		"CNAME":              "docs.example.com\n",
+		"keep-notes.txt":     "notes",
+		"preview/index.html": "preview",
+		"stale.html":         "stale",
+	})
+	gitTest(t, clone, "add", "-A")
+	gitTest(t, clone, "commit", "-q", "-m", "Add files by hand")
+	gitTest(t, clone, "push", "-q", "origin", "gh-pages")
+
+	if !publish(versionedSite(t, "v2.0.0")) {
+		t.Fatal("second publish pushed nothing")
+	}
+	want := []string{
+		".nojekyll",
+		"CNAME",
+		"index.html",
+		"keep-notes.txt",
+		"preview/index.html",
+		"v1.0.0/_assets/style.css",
+		"v1.0.0/index.html",
+		"v2.0.0/_assets/style.css",
+		"v2.0.0/index.html",
+		"versions.json",
+	}
+	if got := branchFiles(t, bare, "gh-pages"); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("branch files\n got: %v\nwant: %v", got, want)
+	}
+	versions := gitTest(t, bare, "show", "gh-pages:versions.json")
+	if !strings.Contains(versions, `"latest": "v2.0.0"`) || !strings.Contains(versions, `"name": "v1.0.0"`) {
+		t.Errorf("versions.json does not list both versions:\n%s", versions)
+	}
+	if log := gitTest(t, bare, "log", "--format=%s", "gh-pages"); log != "Update docs\nAdd files by hand\nUpdate docs\n" {
+		t.Errorf("history not appended to:\n%s", log)
+	}
+
+	// Publishing the same site again changes nothing
+	if publish(versionedSite(t, "v2.0.0")) {
+		t.Error("unchanged site was pushed")
+	}
+	if n := strings.TrimSpace(gitTest(t, bare, "rev-list", "--count", "gh-pages")); n != "3" {
+		t.Errorf("branch has %s commits after an unchanged publish, want 3", n)
+	}
+
+	// Without KeepVersions, only the rebuilt version survives
+	opts.KeepVersions = false
+	if !publish(versionedSite(t, "v2.0.0")) {
+		t.Fatal("publish without KeepVersions pushed nothing")
+	}
+	for _, f := range branchFiles(t, bare, "gh-pages") {
+		if strings.HasPrefix(f, "v1.0.0/") {
+			t.Errorf("%s kept without KeepVersions", f)
+		}
+	}
+}
+
+func TestGitRunCancelled(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := gitRun(ctx, t.TempDir(), "init", "-q"); err == nil {
+		t.Error("git ran with a cancelled context")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runReportName is the file the run report is written to.
+const runReportName = "run-report.json"
+
+// Log formats for the log-format input.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Outcomes of a run, the status of its report.
+const (
+	runSucceeded = "success"
+	runFailed    = "failure"
+	runCancelled = "cancelled"
+)
+
+// logEventPrefix marks stdout lines that already are JSON log events, so
+// the JSON log writer passes them through in order with other output.
+const logEventPrefix = "::arch-docs-event::"
+
+// StageTiming records one stage of a run. Nested stages are named
+// "<parent>.<name>", e.g. "api.poll".
+type StageTiming struct {
+	Name       string           `json:"name"`
+	Start      time.Time        `json:"start"`
+	End        time.Time        `json:"end"`
+	DurationMS int64            `json:"duration_ms"`
+	Metrics    map[string]int64 `json:"metrics,omitempty"`
+}
+
+// RunReport is the machine-readable summary of a run, written as
+// run-report.json.
+type RunReport struct {
+	ArchDocsVersion string           `json:"arch_docs_version,omitempty"`
+	Repository      string           `json:"repository,omitempty"`
+	Commit          string           `json:"commit,omitempty"`
+	ResumedFrom     string           `json:"resumed_from,omitempty"` // first stage run, when resuming
+	ArchiveDigest   string           `json:"archive_digest,omitempty"`
+	Start           time.Time        `json:"start"`
+	End             time.Time        `json:"end"`
+	DurationMS      int64            `json:"duration_ms"`
+	Status          string           `json:"status"` // success, failure or cancelled
+	Error           string           `json:"error,omitempty"`
+	Stages          []*StageTiming   `json:"stages"`
+	Metrics         map[string]int64 `json:"metrics,omitempty"`
+
+	mu   sync.Mutex
+	open []*StageTiming // stages not yet ended, innermost last
+	path string         // where to write the report, once known
+}
+
+// logEvent is a line of the JSON log.
+type logEvent struct {
+	Time       time.Time        `json:"time"`
+	Level      string           `json:"level"`
+	Event      string           `json:"event,omitempty"` // stage_start or stage_end
+	Stage      string           `json:"stage,omitempty"`
+	Message    string           `json:"msg,omitempty"`
+	DurationMS int64            `json:"duration_ms,omitempty"`
+	Metrics    map[string]int64 `json:"metrics,omitempty"`
+}
+
+// report is the report of the current run, and logFormat how it is logged.
+var (
+	report    = newRunReport()
+	logFormat = logFormatText
+	// logDone is closed once the JSON log writer has written all output.
+	logDone chan struct{}
+)
+
+// newRunReport starts a report at the current time.
+func newRunReport() *RunReport {
+	r := &RunReport{
+		Repository: os.Getenv("GITHUB_REPOSITORY"),
+		Commit:     os.Getenv("GITHUB_SHA"),
+		Start:      time.Now().UTC(),
+		Stages:     []*StageTiming{},
+		Metrics:    map[string]int64{},
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "(devel)" {
+		r.ArchDocsVersion = info.Main.Version
+	}
+	return r
+}
+
+// parseLogFormat validates the log-format input.
+func parseLogFormat(s string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(s)); f {
+	case "", logFormatText:
+		return logFormatText, nil
+	case logFormatJSON:
+		return logFormatJSON, nil
+	default:
+		return "", fmt.Errorf("invalid log-format %q: use text or json", s)
+	}
+}
+
+// startJSONLog replaces stdout and stderr with a pipe and writes everything
+// sent to it, including the output of child processes, to the real stdout
+// as one JSON event per line. Workflow command prefixes such as ::warning::
+// become the event level.
+func startJSONLog() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	out := os.Stdout
+	os.Stdout, os.Stderr = w, w
+	logFormat = logFormatJSON
+	logDone = make(chan struct{})
+	go func() {
+		defer close(logDone)
+		writeJSONLog(r, out)
+	}()
+	return nil
+}
+
+// writeJSONLog converts the lines of r into JSON events on out.
+func writeJSONLog(r io.Reader, out io.Writer) {
+	enc := json.NewEncoder(out)
+	stage := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Events are timestamped here too, so the log stays in time order.
+		if ev, ok := strings.CutPrefix(line, logEventPrefix); ok {
+			var e logEvent
+			if json.Unmarshal([]byte(ev), &e) == nil {
+				switch e.Event {
+				case "stage_start":
+					stage = e.Stage
+				case "stage_end":
+					stage = e.Stage[:max(strings.LastIndex(e.Stage, "."), 0)]
+				}
+				e.Time = time.Now().UTC()
+				enc.Encode(e)
+			}
+			continue
+		}
+		e := logEvent{Time: time.Now().UTC(), Level: "info", Stage: stage, Message: line}
+		for _, level := range []string{"error", "warning", "notice", "debug"} {
+			if rest, ok := strings.CutPrefix(line, "::"+level+"::"); ok {
+				e.Level, e.Message = level, rest
+				break
+			}
+		}
+		enc.Encode(e)
+	}
+	// A line too long for the scanner ends the JSON log. The rest is copied
+	// as is, so writers never block on a pipe nobody reads.
+	if err := scanner.Err(); err != nil {
+		enc.Encode(logEvent{Time: time.Now().UTC(), Level: "error", Stage: stage, Message: "JSON log stopped: " + err.Error()})
+		io.Copy(out, r)
+	}
+}
+
+// flushLog waits until the JSON log writer has written all output so far.
+// Nothing may be logged afterwards.
+func flushLog() {
+	if logDone == nil {
+		return
+	}
+	os.Stdout.Close()
+	<-logDone
+	logDone = nil
+}
+
+// emitEvent writes a stage event to the JSON log.
+func emitEvent(e logEvent) {
+	if logFormat != logFormatJSON {
+		return
+	}
+	e.Level = "info"
+	data, _ := json.Marshal(e)
+	fmt.Printf("%s%s\n", logEventPrefix, data)
+}
+
+// beginStage starts timing a stage. Stages begun while another is open are
+// nested in it.
+func (r *RunReport) beginStage(name string) {
+	r.mu.Lock()
+	if n := len(r.open); n > 0 {
+		name = r.open[n-1].Name + "." + name
+	}
+	s := &StageTiming{Name: name, Start: time.Now().UTC()}
+	r.Stages = append(r.Stages, s)
+	r.open = append(r.open, s)
+	r.mu.Unlock()
+	emitEvent(logEvent{Event: "stage_start", Stage: name})
+}
+
+// endStage ends the innermost open stage. It reports whether a stage was
+// open.
+func (r *RunReport) endStage() bool {
+	r.mu.Lock()
+	n := len(r.open)
+	if n == 0 {
+		r.mu.Unlock()
+		return false
+	}
+	s := r.open[n-1]
+	r.open = r.open[:n-1]
+	s.End = time.Now().UTC()
+	s.DurationMS = s.End.Sub(s.Start).Milliseconds()
+	r.mu.Unlock()
+	emitEvent(logEvent{Event: "stage_end", Stage: s.Name, DurationMS: s.DurationMS, Metrics: s.Metrics})
+	return true
+}
+
+// addMetric adds v to a counter of the innermost open stage, or of the run
+// if no stage is open.
+func (r *RunReport) addMetric(name string, v int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.open); n > 0 {
+		s := r.open[n-1]
+		if s.Metrics == nil {
+			s.Metrics = map[string]int64{}
+		}
+		s.Metrics[name] += v
+		return
+	}
+	r.Metrics[name] += v
+}
+
+// setRunMetric sets a run-wide value.
+func (r *RunReport) setRunMetric(name string, v int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Metrics[name] = v
+}
+
+// setResumedFrom records the stage a resumed run started at.
+func (r *RunReport) setResumedFrom(stage string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ResumedFrom = stage
+}
+
+// setArchiveDigest records the digest of the archive sent for analysis.
+func (r *RunReport) setArchiveDigest(digest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ArchiveDigest = digest
+}
+
+// writeTo sets where the report is written by finish.
+func (r *RunReport) writeTo(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path = path
+}
+
+// finish ends any open stages, records the outcome and writes the report if
+// its path is known. errMsg is "" for a successful run.
+func (r *RunReport) finish(status, errMsg string) error {
+	for r.endStage() {
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.End = time.Now().UTC()
+	r.DurationMS = r.End.Sub(r.Start).Milliseconds()
+	r.Status = status
+	r.Error = errMsg
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0644)
+}
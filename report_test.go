@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteJSONLog(t *testing.T) {
+	in := "plain line\n::warning::careful\n" +
+		logEventPrefix + `{"event":"stage_start","stage":"build"}` + "\n" +
+		"::error::broken\n" +
+		logEventPrefix + `{"event":"stage_end","stage":"build"}` + "\n" +
+		"done\n"
+	var out bytes.Buffer
+	writeJSONLog(strings.NewReader(in), &out)
+
+	var got []logEvent
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var e logEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("not JSON: %s", scanner.Text())
+		}
+		got = append(got, e)
+	}
+	want := []logEvent{
+		{Level: "info", Message: "plain line"},
+		{Level: "warning", Message: "careful"},
+		{Event: "stage_start", Stage: "build"},
+		{Level: "error", Stage: "build", Message: "broken"},
+		{Event: "stage_end", Stage: "build"},
+		{Level: "info", Message: "done"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Time.IsZero() {
+			t.Errorf("event %d has no time", i)
+		}
+		if g.Event != w.Event || g.Stage != w.Stage || g.Message != w.Message || (w.Level != "" && g.Level != w.Level) {
+			t.Errorf("event %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+// A line longer than the scanner accepts must not leave the writer blocked.
+func TestWriteJSONLogDrainsAfterLongLine(t *testing.T) {
+	r, w := io.Pipe()
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeJSONLog(r, &out)
+	}()
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(w, "before\n"+strings.Repeat("x", 11*1024*1024)+"\nafter\n")
+		w.Close()
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("writer blocked after the long line")
+	}
+	<-done
+	if s := out.String(); !strings.Contains(s, `"msg":"before"`) || !strings.Contains(s, "JSON log stopped") || !strings.HasSuffix(s, "after\n") {
+		t.Errorf("unexpected log output (%d bytes): %.200s ... %s", len(s), s, s[max(len(s)-100, 0):])
+	}
+}
+
+func TestRunReportFinishEndsOpenStages(t *testing.T) {
+	r := newRunReport()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.beginStage("stage")
+			r.addMetric("n", 1)
+		}()
+	}
+	wg.Wait()
+	if err := r.finish(runSucceeded, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range r.Stages {
+		if s.End.IsZero() {
+			t.Errorf("stage %s not ended", s.Name)
+		}
+	}
+	if r.Status != runSucceeded {
+		t.Errorf("status = %q", r.Status)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// urlAttributes are the HTML attributes whose value is a single URL.
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"poster":     true,
+	"cite":       true,
+	"data":       true,
+	"background": true,
+	"xlink:href": true,
+}
+
+// srcsetAttributes are the HTML attributes holding a comma-separated list of
+// "URL [descriptor]" candidates.
+var srcsetAttributes = map[string]bool{
+	"srcset":      true,
+	"imagesrcset": true,
+}
+
+// rawTextElements are HTML elements whose content is not markup.
+var rawTextElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"textarea": true,
+	"title":    true,
+}
+
+// xmlURLElements are sitemap and feed elements whose text is a URL.
+var xmlURLElements = map[string]bool{
+	"loc":  true,
+	"link": true,
+	"guid": true,
+	"id":   true,
+	"icon": true,
+	"logo": true,
+}
+
+// jsURLPattern matches the start of a root-relative URL in JavaScript:
+// string literals building href/src attributes, fetch() calls and location
+// assignments. Each pattern ends with the leading slash of the URL.
+var jsURLPattern = regexp.MustCompile(`(?:\b(?:href|src|action)=|\bfetch\(\s*|\blocation(?:\.href)?\s*=\s*)["'` + "`" + `]/`)
+
+// cssURLPattern matches the start of a root-relative url() or @import.
+var cssURLPattern = regexp.MustCompile(`(?:\burl\(\s*["']?|@import\s+["'])/`)
+
+// jsonURLPattern matches the start of a root-relative string value of a
+// URL-bearing key in search indexes and web app manifests.
+var jsonURLPattern = regexp.MustCompile(`"(?:url|href|src|start_url|scope|link)"\s*:\s*"/`)
+
+// escapedURLPattern matches href/src attributes inside entity-escaped HTML,
+// as found in RSS descriptions.
+var escapedURLPattern = regexp.MustCompile(`\b(?:href|src)=(?:&quot;|&#34;|&#39;)/`)
+
+// rewritePathPrefix rewrites root-relative URLs in the built site to include
+// the given prefix. This is needed when deploying to a subdirectory (e.g.
+// GitHub Pages project sites at username.github.io/repo/). Only URL-bearing
+// HTML attributes, inline and external scripts and styles, search indexes,
+// manifests, sitemaps and feeds are touched; text content, including code
+// samples, is left alone.
+func rewritePathPrefix(dir, prefix string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rewrite := prefixRewriter{prefix: prefix}.forFile(path)
+		if rewrite == nil {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		content := rewrite(string(data))
+		if content != string(data) {
+			if err := os.WriteFile(path, []byte(content), info.Mode()); err != nil {
+				return fmt.Errorf("writing %s: %w", path, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// prefixRewriter inserts a path prefix into root-relative URLs. If onURL is
+// set, it is called with every URL-bearing attribute value and XML URL the
+// rewriter visits, which lets the link checker reuse the tokenizer.
+type prefixRewriter struct {
+	prefix string
+	onURL  func(u string)
+}
+
+// forFile returns the rewrite function for a file, or nil if files of its
+// type contain no rewritable URLs.
+func (r prefixRewriter) forFile(path string) func(string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return func(s string) string { return r.markup(s, false) }
+	case ".xml", ".rss", ".atom":
+		return func(s string) string { return r.markup(s, true) }
+	case ".js":
+		return r.js
+	case ".css":
+		return r.css
+	case ".json", ".webmanifest":
+		return r.json
+	}
+	return nil
+}
+
+// url rewrites a single attribute value or URL. Protocol-relative ("//host"),
+// non-root-relative and already prefixed URLs are returned unchanged.
+func (r prefixRewriter) url(u string) string {
+	if r.onURL != nil {
+		r.onURL(u)
+	}
+	trimmed := strings.TrimLeft(u, " \t\n\r\f")
+	if !strings.HasPrefix(trimmed, "/") || strings.HasPrefix(trimmed, "//") || r.hasPrefix(trimmed) {
+		return u
+	}
+	lead := u[:len(u)-len(trimmed)]
+	return lead + r.prefix + trimmed
+}
+
+// hasPrefix reports whether the root-relative URL at the start of s already
+// starts with the prefix, as pages kept from an earlier build do.
+func (r prefixRewriter) hasPrefix(s string) bool {
+	if r.prefix == "" || !strings.HasPrefix(s, r.prefix) {
+		return false
+	}
+	rest := s[len(r.prefix):]
+	return rest == "" || strings.IndexByte("/?#\"'`) \t\n\r\f,", rest[0]) >= 0
+}
+
+// srcset rewrites every candidate URL of a srcset value.
+func (r prefixRewriter) srcset(v string) string {
+	candidates := strings.Split(v, ",")
+	for i, c := range candidates {
+		candidates[i] = r.url(c)
+	}
+	return strings.Join(candidates, ",")
+}
+
+// js rewrites root-relative URLs in JavaScript source.
+func (r prefixRewriter) js(s string) string {
+	return r.insertAt(s, jsURLPattern)
+}
+
+// css rewrites root-relative url() and @import references.
+func (r prefixRewriter) css(s string) string {
+	return r.insertAt(s, cssURLPattern)
+}
+
+// json rewrites root-relative values of URL-bearing keys.
+func (r prefixRewriter) json(s string) string {
+	return r.insertAt(s, jsonURLPattern)
+}
+
+// insertAt inserts the prefix before the slash that ends each match of re,
+// unless the URL is protocol-relative or already prefixed.
+func (r prefixRewriter) insertAt(s string, re *regexp.Regexp) string {
+	matches := re.FindAllStringIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		slash := m[1] - 1
+		if m[1] < len(s) && s[m[1]] == '/' || r.hasPrefix(s[slash:]) {
+			continue
+		}
+		b.WriteString(s[last:slash])
+		b.WriteString(r.prefix)
+		last = slash
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// markup rewrites URL-bearing attributes of every tag in an HTML or XML
+// document. Text content is copied unchanged, except that in XML the text of
+// URL elements such as <loc> and escaped HTML in feed bodies are rewritten.
+func (r prefixRewriter) markup(s string, xml bool) string {
+	var b strings.Builder
+	b.Grow(len(s) + len(s)/50)
+	lastTag := ""
+	for i := 0; i < len(s); {
+		lt := strings.IndexByte(s[i:], '<')
+		if lt < 0 {
+			b.WriteString(r.text(s[i:], lastTag, xml))
+			break
+		}
+		b.WriteString(r.text(s[i:i+lt], lastTag, xml))
+		i += lt
+		rest := s[i:]
+
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			i += copyThrough(&b, rest, "-->")
+		case strings.HasPrefix(rest, "<![CDATA["):
+			end := strings.Index(rest, "]]>")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += len("]]>")
+			}
+			inner := strings.TrimSuffix(strings.TrimPrefix(rest[:end], "<![CDATA["), "]]>")
+			if xmlURLElements[lastTag] {
+				inner = r.url(inner)
+			} else {
+				inner = r.markup(inner, false)
+			}
+			b.WriteString("<![CDATA[" + inner)
+			if strings.HasSuffix(rest[:end], "]]>") {
+				b.WriteString("]]>")
+			}
+			i += end
+		case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"), strings.HasPrefix(rest, "</"):
+			i += copyThrough(&b, rest, ">")
+			lastTag = ""
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			name, attrs, n := r.startTag(&b, rest)
+			i += n
+			lastTag = name
+			if xml || !rawTextElements[name] {
+				continue
+			}
+			// Copy raw text up to the closing tag, rewriting inline scripts
+			// and styles.
+			end := indexFold(s[i:], "</"+name)
+			if end < 0 {
+				end = len(s) - i
+			}
+			body := s[i : i+end]
+			switch name {
+			case "script":
+				if strings.Contains(strings.ToLower(attrs["type"]), "json") {
+					body = r.json(body)
+				} else {
+					body = r.js(body)
+				}
+			case "style":
+				body = r.css(body)
+			}
+			b.WriteString(body)
+			i += end
+			lastTag = ""
+		default:
+			b.WriteByte('<')
+			i++
+		}
+	}
+	return b.String()
+}
+
+// text rewrites character data. HTML text is never changed; in XML the
+// content of URL elements and escaped attributes in feed bodies are.
+func (r prefixRewriter) text(s, lastTag string, xml bool) string {
+	if !xml || s == "" {
+		return s
+	}
+	if xmlURLElements[lastTag] {
+		return r.url(s)
+	}
+	return r.insertAt(s, escapedURLPattern)
+}
+
+// startTag copies the start tag at the beginning of s to b, rewriting its
+// URL-bearing attributes. It returns the lowercased tag name, the attribute
+// values and the number of bytes consumed.
+func (r prefixRewriter) startTag(b *strings.Builder, s string) (string, map[string]string, int) {
+	i := 1
+	for i < len(s) && !isTagSpace(s[i]) && s[i] != '>' && s[i] != '/' {
+		i++
+	}
+	name := strings.ToLower(s[1:i])
+	b.WriteString(s[:i])
+	attrs := map[string]string{}
+
+	for i < len(s) {
+		// Whitespace and stray slashes between attributes.
+		start := i
+		for i < len(s) && (isTagSpace(s[i]) || s[i] == '/') {
+			i++
+		}
+		b.WriteString(s[start:i])
+		if i >= len(s) {
+			break
+		}
+		if s[i] == '>' {
+			b.WriteByte('>')
+			return name, attrs, i + 1
+		}
+
+		start = i
+		for i < len(s) && !isTagSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		attr := strings.ToLower(s[start:i])
+		b.WriteString(s[start:i])
+
+		// Optional "= value", with whitespace allowed around "=".
+		j := i
+		for j < len(s) && isTagSpace(s[j]) {
+			j++
+		}
+		if j >= len(s) || s[j] != '=' {
+			continue
+		}
+		j++
+		for j < len(s) && isTagSpace(s[j]) {
+			j++
+		}
+		b.WriteString(s[i:j])
+		i = j
+
+		var value, quote string
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			quote = s[i : i+1]
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				end = len(s) - i - 1
+			}
+			value = s[i+1 : i+1+end]
+			i += 1 + end
+			if i < len(s) {
+				i++
+			}
+		} else {
+			start = i
+			for i < len(s) && !isTagSpace(s[i]) && s[i] != '>' {
+				i++
+			}
+			value = s[start:i]
+		}
+		attrs[attr] = value
+
+		switch {
+		case urlAttributes[attr]:
+			value = r.url(value)
+		case srcsetAttributes[attr]:
+			value = r.srcset(value)
+		case attr == "style":
+			value = r.css(value)
+		}
+		b.WriteString(quote + value + quote)
+	}
+	return name, attrs, len(s)
+}
+
+// copyThrough copies s up to and including the first occurrence of end (or
+// all of s) to b and returns the number of bytes copied.
+func copyThrough(b *strings.Builder, s, end string) int {
+	n := strings.Index(s, end)
+	if n < 0 {
+		n = len(s)
+	} else {
+		n += len(end)
+	}
+	b.WriteString(s[:n])
+	return n
+}
+
+// indexFold is strings.Index ignoring ASCII case.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isTagSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
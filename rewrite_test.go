@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrefixRewriterMarkup(t *testing.T) {
+	r := prefixRewriter{prefix: "/repo"}
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"double-quoted attributes",
+			`<a href="/about/">About</a><img src="/img/logo.png">`,
+			`<a href="/repo/about/">About</a><img src="/repo/img/logo.png">`,
+		},
+		{
+			"single-quoted and unquoted attributes",
+			`<a href='/about/'>About</a><link rel=stylesheet href=/style.css>`,
+			`<a href='/repo/about/'>About</a><link rel=stylesheet href=/repo/style.css>`,
+		},
+		{
+			"srcset lists",
+			`<img srcset="/a.png 1x, /b.png 2x,https://cdn.example.com/c.png 3x">`,
+			`<img srcset="/repo/a.png 1x, /repo/b.png 2x,https://cdn.example.com/c.png 3x">`,
+		},
+		{
+			"form action",
+			`<form action="/search/" method="get"><button formaction="/go">Go</button></form>`,
+			`<form action="/repo/search/" method="get"><button formaction="/repo/go">Go</button></form>`,
+		},
+		{
+			"inline css url()",
+			`<div style="background: url(/bg.png)"></div><style>@import "/theme.css"; .x { background: url('/x.png') }</style>`,
+			`<div style="background: url(/repo/bg.png)"></div><style>@import "/repo/theme.css"; .x { background: url('/repo/x.png') }</style>`,
+		},
+		{
+			"inline script",
+			`<script>fetch("/search-index.json"); location.href = '/home/';</script>`,
+			`<script>fetch("/repo/search-index.json"); location.href = '/repo/home/';</script>`,
+		},
+		{
+			"protocol-relative and external URLs",
+			`<a href="//cdn.example.com/x.js">x</a><a href="https://example.com/">e</a><a href="#top">t</a>`,
+			`<a href="//cdn.example.com/x.js">x</a><a href="https://example.com/">e</a><a href="#top">t</a>`,
+		},
+		{
+			"already prefixed URLs",
+			`<a href="/repo/about/">About</a><a href="/repo">Home</a><a href="/repo?q=1">Q</a><img srcset="/repo/a.png 1x">`,
+			`<a href="/repo/about/">About</a><a href="/repo">Home</a><a href="/repo?q=1">Q</a><img srcset="/repo/a.png 1x">`,
+		},
+		{
+			"paths that only start like the prefix",
+			`<a href="/repository/">Repository</a>`,
+			`<a href="/repo/repository/">Repository</a>`,
+		},
+		{
+			"source code stays byte-identical",
+			`<pre class="source-code"><code>&lt;a href=&quot;/about/&quot;&gt; fetch("/api") url(/x.png)</code></pre>`,
+			`<pre class="source-code"><code>&lt;a href=&quot;/about/&quot;&gt; fetch("/api") url(/x.png)</code></pre>`,
+		},
+		{
+			"text and comments",
+			`<p>See href="/about/" in the docs</p><!-- <a href="/old/"> -->`,
+			`<p>See href="/about/" in the docs</p><!-- <a href="/old/"> -->`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.markup(tt.in, false); got != tt.want {
+				t.Errorf("markup(%s)\n got: %s\nwant: %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixRewriterXML(t *testing.T) {
+	r := prefixRewriter{prefix: "/repo"}
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"sitemap",
+			`<urlset><url><loc>/about/</loc></url><url><loc>https://example.com/repo/x/</loc></url></urlset>`,
+			`<urlset><url><loc>/repo/about/</loc></url><url><loc>https://example.com/repo/x/</loc></url></urlset>`,
+		},
+		{
+			"rss",
+			`<rss><channel><link>/</link><item><link>/a/</link><guid><![CDATA[/a/]]></guid>` +
+				`<description>&lt;a href=&quot;/b/&quot;&gt;b&lt;/a&gt;</description><title>/not-a-url/</title></item></channel></rss>`,
+			`<rss><channel><link>/repo/</link><item><link>/repo/a/</link><guid><![CDATA[/repo/a/]]></guid>` +
+				`<description>&lt;a href=&quot;/repo/b/&quot;&gt;b&lt;/a&gt;</description><title>/not-a-url/</title></item></channel></rss>`,
+		},
+		{
+			"already prefixed",
+			`<urlset><url><loc>/repo/about/</loc></url></urlset>`,
+			`<urlset><url><loc>/repo/about/</loc></url></urlset>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.markup(tt.in, true); got != tt.want {
+				t.Errorf("markup(%s)\n got: %s\nwant: %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewritePathPrefix(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][2]string{
+		"index.html": {
+			`<a href="/about/">About</a><pre class="source-code">href="/x"</pre>`,
+			`<a href="/repo/about/">About</a><pre class="source-code">href="/x"</pre>`,
+		},
+		"search-index.json": {
+			`[{"title":"A","url":"/a/","path":"/src/a.go"},{"url":"https://example.com/"}]`,
+			`[{"title":"A","url":"/repo/a/","path":"/src/a.go"},{"url":"https://example.com/"}]`,
+		},
+		"manifest.json": {
+			`{"start_url": "/", "scope": "/", "icons": [{"src": "/icon.png"}]}`,
+			`{"start_url": "/repo/", "scope": "/repo/", "icons": [{"src": "/repo/icon.png"}]}`,
+		},
+		"sitemap.xml": {
+			`<urlset><url><loc>/a/</loc></url></urlset>`,
+			`<urlset><url><loc>/repo/a/</loc></url></urlset>`,
+		},
+		"feed.rss": {
+			`<rss><channel><link>/</link></channel></rss>`,
+			`<rss><channel><link>/repo/</link></channel></rss>`,
+		},
+		"css/site.css": {
+			`body { background: url("/bg.png") } .x { background: url(//cdn.example.com/y.png) }`,
+			`body { background: url("/repo/bg.png") } .x { background: url(//cdn.example.com/y.png) }`,
+		},
+		"js/app.js": {
+			"el.innerHTML = `<a href=\"/x/\">`; fetch('/search/shard.json')",
+			"el.innerHTML = `<a href=\"/repo/x/\">`; fetch('/repo/search/shard.json')",
+		},
+		"notes.txt": {
+			`href="/about/"`,
+			`href="/about/"`,
+		},
+	}
+	for name, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f[0]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A second pass, as over pages kept from an earlier build, changes nothing
+	for pass := 1; pass <= 2; pass++ {
+		if err := rewritePathPrefix(dir, "/repo"); err != nil {
+			t.Fatal(err)
+		}
+		for name, f := range files {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != f[1] {
+				t.Errorf("pass %d: %s\n got: %s\nwant: %s", pass, name, data, f[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3UploadWorkers is the number of concurrent uploads.
+const s3UploadWorkers = 8
+
+// s3DeleteBatch is the maximum number of keys per DeleteObjects request.
+const s3DeleteBatch = 1000
+
+// s3ContentTypes overrides mime.TypeByExtension for the file types a site
+// contains, so uploads don't depend on the container's mime database.
+var s3ContentTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".json":  "application/json",
+	".xml":   "application/xml",
+	".txt":   "text/plain; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".ico":   "image/x-icon",
+	".woff2": "font/woff2",
+	".gz":    "application/gzip",
+}
+
+// s3CacheControl returns the Cache-Control header for a key. Pages and
+// indexes must pick up new builds immediately; assets are not fingerprinted,
+// so they are only cached for a day.
+func s3CacheControl(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".html", ".xml", ".txt", "":
+		return "public, max-age=0, must-revalidate"
+	case ".json":
+		return "public, max-age=300"
+	default:
+		return "public, max-age=86400"
+	}
+}
+
+// s3ContentType returns the Content-Type header for a key.
+func s3ContentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if t, ok := s3ContentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// S3Target is a bucket location and the credentials to write to it.
+type S3Target struct {
+	Bucket       string
+	Prefix       string // key prefix, without leading or trailing slash
+	Region       string
+	Endpoint     string // custom endpoint (e.g. MinIO); uses path-style URLs
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Delete       bool // delete objects under Prefix that are not in the site
+}
+
+// newS3Target builds the deploy target from the s3-* inputs and the standard
+// AWS_* credential environment variables. region falls back to AWS_REGION
+// and then us-east-1.
+func newS3Target(bucket, prefix, region, endpoint string, del bool) (*S3Target, error) {
+	t := &S3Target{
+		Bucket:       bucket,
+		Prefix:       strings.Trim(prefix, "/"),
+		Region:       region,
+		Endpoint:     endpoint,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Delete:       del,
+	}
+	if t.Region == "" {
+		t.Region = os.Getenv("AWS_REGION")
+	}
+	if t.Region == "" {
+		t.Region = "us-east-1"
+	}
+	if t.AccessKey == "" || t.SecretKey == "" {
+		return nil, fmt.Errorf("s3-bucket is set but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not")
+	}
+	if t.Delete && t.Prefix == "" {
+		fmt.Printf("::warning::s3-delete is set without s3-prefix: objects anywhere in s3://%s that are not in the site will be deleted\n", t.Bucket)
+	}
+	return t, nil
+}
+
+// S3SyncResult summarizes a sync.
+type S3SyncResult struct {
+	Uploaded  int
+	Unchanged int
+	Deleted   int
+}
+
+// s3Client is a minimal S3 API client signing requests with AWS Signature
+// Version 4. It covers the three calls a sync needs, so the action doesn't
+// pull in the AWS SDK.
+type s3Client struct {
+	ctx    context.Context // cancels the requests of a sync
+	target S3Target
+	http   *http.Client
+}
+
+// s3Object is an entry of a ListObjectsV2 response.
+type s3Object struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+}
+
+// syncToS3 uploads every file in dir whose content differs from the object
+// under the same key, except the incremental build manifest, then deletes objects that no longer exist locally if
+// t.Delete is set. Assets are uploaded before pages so a page never
+// references an asset that isn't there yet. Cancelling ctx aborts the
+// requests in flight.
+func syncToS3(ctx context.Context, dir string, t S3Target) (*S3SyncResult, error) {
+	c := &s3Client{ctx: ctx, target: t, http: &http.Client{Timeout: 5 * time.Minute}}
+
+	remote, err := c.list()
+	if err != nil {
+		return nil, fmt.Errorf("listing s3://%s/%s: %w", t.Bucket, t.Prefix, err)
+	}
+
+	local := map[string]string{} // key -> file path
+	var keys []string
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == buildManifestName {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		key := path.Join(t.Prefix, filepath.ToSlash(rel))
+		local[key] = p
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	res := &S3SyncResult{}
+	var toUpload []string
+	for _, key := range keys {
+		sum, err := fileMD5(local[key])
+		if err != nil {
+			return nil, err
+		}
+		// For single-part uploads the ETag is the MD5 of the content.
+		if etag, ok := remote[key]; ok && etag == sum {
+			res.Unchanged++
+			continue
+		}
+		toUpload = append(toUpload, key)
+	}
+
+	var html, assets []string
+	for _, key := range toUpload {
+		if strings.HasSuffix(key, ".html") {
+			html = append(html, key)
+		} else {
+			assets = append(assets, key)
+		}
+	}
+	for _, batch := range [][]string{assets, html} {
+		if err := c.putAll(batch, local); err != nil {
+			return nil, err
+		}
+		res.Uploaded += len(batch)
+	}
+
+	if t.Delete {
+		var stale []string
+		for key := range remote {
+			if _, ok := local[key]; !ok {
+				stale = append(stale, key)
+			}
+		}
+		sort.Strings(stale)
+		for i := 0; i < len(stale); i += s3DeleteBatch {
+			end := i + s3DeleteBatch
+			if end > len(stale) {
+				end = len(stale)
+			}
+			if err := c.deleteObjects(stale[i:end]); err != nil {
+				return nil, err
+			}
+			res.Deleted += end - i
+		}
+	}
+	return res, nil
+}
+
+// putAll uploads keys with a pool of workers.
+func (c *s3Client) putAll(keys []string, local map[string]string) error {
+	jobs := make(chan string)
+	errs := make(chan error, len(keys))
+	var wg sync.WaitGroup
+	for w := 0; w < s3UploadWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				if err := c.put(key, local[key]); err != nil {
+					errs <- fmt.Errorf("uploading %s: %w", key, err)
+				}
+			}
+		}()
+	}
+	for _, key := range keys {
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// list returns the ETag (without quotes) of every object under the prefix.
+func (c *s3Client) list() (map[string]string, error) {
+	objects := map[string]string{}
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}}
+		if c.target.Prefix != "" {
+			q.Set("prefix", c.target.Prefix+"/")
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		body, err := c.do("GET", "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("parsing ListObjectsV2 response: %w", err)
+		}
+		for _, o := range page.Contents {
+			objects[o.Key] = strings.Trim(o.ETag, `"`)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// put uploads a file with its Content-Type and Cache-Control.
+func (c *s3Client) put(key, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	_, err = c.do("PUT", key, nil, map[string]string{
+		"Content-Type":  s3ContentType(key),
+		"Cache-Control": s3CacheControl(key),
+	}, data)
+	return err
+}
+
+// deleteObjects removes up to s3DeleteBatch keys in one request.
+func (c *s3Client) deleteObjects(keys []string) error {
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	req := struct {
+		XMLName xml.Name `xml:"Delete"`
+		Quiet   bool     `xml:"Quiet"`
+		Objects []object `xml:"Object"`
+	}{Quiet: true}
+	for _, k := range keys {
+		req.Objects = append(req.Objects, object{k})
+	}
+	payload, err := xml.Marshal(req)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(payload)
+	body, err := c.do("POST", "", url.Values{"delete": {""}}, map[string]string{
+		"Content-Type": "application/xml",
+		"Content-MD5":  base64.StdEncoding.EncodeToString(sum[:]),
+	}, payload)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Errors []struct {
+			Key     string `xml:"Key"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	if err := xml.Unmarshal(body, &result); err == nil && len(result.Errors) > 0 {
+		e := result.Errors[0]
+		return fmt.Errorf("deleting %s: %s (%d errors)", e.Key, e.Message, len(result.Errors))
+	}
+	return nil
+}
+
+// objectURL returns the URL of key (or of the bucket if key is empty).
+// Custom endpoints use path-style addressing, AWS virtual-hosted style.
+func (c *s3Client) objectURL(key string, q url.Values) *url.URL {
+	u := &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", c.target.Bucket, c.target.Region), Path: "/" + key}
+	if c.target.Endpoint != "" {
+		ep, err := url.Parse(strings.TrimRight(c.target.Endpoint, "/"))
+		if err == nil && ep.Host != "" {
+			u.Scheme, u.Host = ep.Scheme, ep.Host
+			u.Path = ep.Path + "/" + c.target.Bucket + "/" + key
+		}
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = canonicalQuery(q)
+	return u
+}
+
+// s3EscapePath percent-encodes every byte of p except unreserved characters
+// and slashes, which is the path encoding SigV4 signs.
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// do sends a signed request and returns the response body, or an error for
+// non-2xx responses.
+func (c *s3Client) do(method, key string, q url.Values, headers map[string]string, payload []byte) ([]byte, error) {
+	u := c.objectURL(key, q)
+	req, err := http.NewRequestWithContext(c.ctx, method, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	c.sign(req, u, payload, time.Now().UTC())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s", method, u.Path, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("%s %s: HTTP %d", method, u.Path, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+func (c *s3Client) sign(req *http.Request, u *url.URL, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", u.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.target.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.target.SessionToken)
+	}
+
+	canonical, signedHeaders := canonicalRequest(req, u, payloadHash)
+	scope := day + "/" + c.target.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+c.target.SecretKey), day)
+	key = hmacSHA256(key, c.target.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.target.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalRequest returns the SigV4 canonical request for req, which signs
+// every header set on it, and the list of signed headers.
+func canonicalRequest(req *http.Request, u *url.URL, payloadHash string) (string, string) {
+	var names []string
+	for k := range req.Header {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		v := u.Host
+		if k != "host" {
+			v = strings.TrimSpace(req.Header.Get(k))
+		}
+		canonHeaders.WriteString(k + ":" + v + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	return strings.Join([]string{
+		req.Method,
+		u.EscapedPath(),
+		u.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+// canonicalQuery encodes q sorted by key with %20 for spaces, as SigV4
+// requires.
+func canonicalQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// fileMD5 returns the hex MD5 of a file's content.
+func fileMD5(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
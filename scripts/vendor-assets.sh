@@ -0,0 +1,72 @@
+#!/bin/sh
+# Downloads the pinned assets listed in assets/vendor.txt into assets/vendor/,
+# from where they are embedded into the binary for self-hosted sites. Each
+# download must match the SHA-256 recorded for it, or the script fails.
+#
+# After changing a URL, run with --pin to download the files and record
+# their checksums in assets/vendor.txt; review the diff before committing.
+set -euf
+cd "$(dirname "$0")/.."
+
+pin=false
+if [ "${1:-}" = "--pin" ]; then
+  pin=true
+fi
+
+sha256() {
+  if command -v sha256sum >/dev/null 2>&1; then
+    sha256sum "$1" | cut -d' ' -f1
+  else
+    shasum -a 256 "$1" | cut -d' ' -f1
+  fi
+}
+
+mkdir -p assets/vendor
+pinned=$(mktemp)
+trap 'rm -f "$pinned"' EXIT
+
+failed=0
+unpinned=0
+while IFS= read -r line; do
+  case "$line" in
+  '' | '#'*)
+    printf '%s\n' "$line" >>"$pinned"
+    continue
+    ;;
+  esac
+  set -- $line
+  if [ $# -ne 3 ]; then
+    echo "assets/vendor.txt: expected <file> <sha256> <url>: $line" >&2
+    exit 1
+  fi
+  name=$1 sum=$2 url=$3
+
+  # An entry without a pin is an error before anything is downloaded, so it
+  # can't be mistaken for a changed file.
+  if [ "$pin" = false ] && ! printf '%s' "$sum" | grep -Eq '^[0-9a-f]{64}$'; then
+    echo "$name: no SHA-256 pinned in assets/vendor.txt (found '$sum')" >&2
+    unpinned=1
+    continue
+  fi
+
+  echo "Fetching $name"
+  curl -fsSL -o "assets/vendor/$name" "$url"
+  got=$(sha256 "assets/vendor/$name")
+  printf '%s %s %s\n' "$name" "$got" "$url" >>"$pinned"
+  if [ "$pin" = false ] && [ "$got" != "$sum" ]; then
+    echo "$name: SHA-256 is $got, assets/vendor.txt pins $sum" >&2
+    rm -f "assets/vendor/$name"
+    failed=1
+  fi
+done <assets/vendor.txt
+
+if [ "$pin" = true ]; then
+  cp "$pinned" assets/vendor.txt
+  echo "Pinned checksums written to assets/vendor.txt"
+elif [ "$unpinned" -ne 0 ]; then
+  echo "Unpinned assets; run scripts/vendor-assets.sh --pin and commit assets/vendor.txt" >&2
+  exit 1
+elif [ "$failed" -ne 0 ]; then
+  echo "Checksum mismatch; if the new files are expected, run scripts/vendor-assets.sh --pin" >&2
+  exit 1
+fi
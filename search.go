@@ -0,0 +1,196 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// searchShardDir is where the sharded search index is written in the site.
+const searchShardDir = "search"
+
+// searchDocsPerChunk is how many entries each document chunk holds.
+const searchDocsPerChunk = 500
+
+// Weights of a token by where it occurs in an entry. A token keeps its
+// highest weight per entry.
+const (
+	searchWeightTitle     = 100 // the whole title, e.g. "parsehttprequest"
+	searchWeightTitlePart = 30  // a camelCase, snake_case or path part of the title
+	searchWeightSlug      = 8
+	searchWeightFacet     = 5 // node type, language, domain
+	searchWeightDesc      = 2
+)
+
+// Word boundaries inside identifiers: "parseHTTP" and "HTTPRequest". The
+// search overlay in _main.js tokenizes queries with the same expressions.
+var (
+	camelLowerUpper = regexp.MustCompile(`([\p{Ll}\p{N}])(\p{Lu})`)
+	camelUpperWord  = regexp.MustCompile(`(\p{Lu})(\p{Lu}\p{Ll})`)
+	searchSeparator = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// SearchEntry is an entry of pssg's search-index.json.
+type SearchEntry struct {
+	Title       string `json:"t"`
+	Description string `json:"d,omitempty"`
+	NodeType    string `json:"n,omitempty"`
+	Language    string `json:"l,omitempty"`
+	Domain      string `json:"m,omitempty"`
+	Slug        string `json:"s"`
+}
+
+// SearchManifest describes the sharded index to the search overlay.
+// Documents are numbered by their position in search-index.json; document n
+// is entry n%Chunk of d-<n/Chunk>.json.gz.
+type SearchManifest struct {
+	Docs   int      `json:"docs"`
+	Chunk  int      `json:"chunk"`
+	Shards []string `json:"shards"` // token shard keys, each in t-<key>.json.gz
+}
+
+// searchTokens splits s into lowercase words on separators and camelCase
+// boundaries. Single-character words are dropped.
+func searchTokens(s string) []string {
+	s = camelLowerUpper.ReplaceAllString(s, "$1 $2")
+	s = camelUpperWord.ReplaceAllString(s, "$1 $2")
+	var tokens []string
+	for _, t := range searchSeparator.Split(strings.ToLower(s), -1) {
+		if utf8.RuneCountInString(t) > 1 {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// searchShardKey returns the shard a token is stored in: its first two
+// characters, or "_" if they are not ASCII letters or digits.
+func searchShardKey(token string) string {
+	if len(token) < 2 {
+		return "_"
+	}
+	for _, c := range token[:2] {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return "_"
+		}
+	}
+	return token[:2]
+}
+
+// writeSearchShards splits siteDir/search-index.json into an inverted index
+// sharded by token prefix plus chunks of entries, all gzip-compressed, so
+// the search overlay only downloads what a query needs. It returns nil if
+// the site has no search index.
+func writeSearchShards(siteDir string) (*SearchManifest, error) {
+	data, err := os.ReadFile(filepath.Join(siteDir, "search-index.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []SearchEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing search-index.json: %w", err)
+	}
+
+	weights := map[string]map[int]int{} // token -> doc -> weight
+	add := func(doc, weight int, tokens ...string) {
+		for _, t := range tokens {
+			if weights[t] == nil {
+				weights[t] = map[int]int{}
+			}
+			if weights[t][doc] < weight {
+				weights[t][doc] = weight
+			}
+		}
+	}
+	for doc, e := range entries {
+		parts := searchTokens(e.Title)
+		add(doc, searchWeightDesc, searchTokens(e.Description)...)
+		add(doc, searchWeightFacet, searchTokens(e.NodeType+" "+e.Language+" "+e.Domain)...)
+		add(doc, searchWeightSlug, searchTokens(e.Slug)...)
+		add(doc, searchWeightTitlePart, parts...)
+		if whole := strings.Join(parts, ""); utf8.RuneCountInString(whole) > 1 {
+			add(doc, searchWeightTitle, whole)
+		}
+	}
+
+	shards := map[string]map[string][]int{}
+	for token, docs := range weights {
+		ids := make([]int, 0, len(docs))
+		for doc := range docs {
+			ids = append(ids, doc)
+		}
+		sort.Ints(ids)
+		// Postings are flat [doc, weight, doc, weight, ...] pairs. Every
+		// document is listed: the overlay intersects the postings of all
+		// terms, so dropping any, even for common words, would lose matches.
+		postings := make([]int, 0, 2*len(ids))
+		for _, doc := range ids {
+			postings = append(postings, doc, docs[doc])
+		}
+		key := searchShardKey(token)
+		if shards[key] == nil {
+			shards[key] = map[string][]int{}
+		}
+		shards[key][token] = postings
+	}
+
+	dir := filepath.Join(siteDir, searchShardDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m := &SearchManifest{Docs: len(entries), Chunk: searchDocsPerChunk, Shards: []string{}}
+	for key, tokens := range shards {
+		if err := writeGzipJSON(filepath.Join(dir, "t-"+key+".json.gz"), tokens); err != nil {
+			return nil, err
+		}
+		m.Shards = append(m.Shards, key)
+	}
+	sort.Strings(m.Shards)
+	for start := 0; start < len(entries); start += searchDocsPerChunk {
+		end := min(start+searchDocsPerChunk, len(entries))
+		name := fmt.Sprintf("d-%d.json.gz", start/searchDocsPerChunk)
+		if err := writeGzipJSON(filepath.Join(dir, name), entries[start:end]); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err = json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644)
+}
+
+// writeGzipJSON writes v as gzip-compressed JSON.
+func writeGzipJSON(path string, v interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readSearchShard decodes a token shard written by writeSearchShards.
+func readSearchShard(t *testing.T, siteDir, key string) map[string][]int {
+	t.Helper()
+	f, err := os.Open(filepath.Join(siteDir, searchShardDir, "t-"+key+".json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shard map[string][]int
+	if err := json.NewDecoder(zr).Decode(&shard); err != nil {
+		t.Fatal(err)
+	}
+	return shard
+}
+
+// hasPosting reports whether postings list doc, with its weight.
+func hasPosting(postings []int, doc int) (int, bool) {
+	for i := 0; i < len(postings); i += 2 {
+		if postings[i] == doc {
+			return postings[i+1], true
+		}
+	}
+	return 0, false
+}
+
+func TestWriteSearchShardsKeepsCommonTokens(t *testing.T) {
+	// Every entry mentions "handler" in its description; one of the last is
+	// also titled "RequestParser". A query for both must find it.
+	const n = 5000
+	entries := make([]SearchEntry, n)
+	for i := range entries {
+		entries[i] = SearchEntry{Title: fmt.Sprintf("Func%d", i), Description: "A handler", Slug: fmt.Sprintf("fn-func%d", i)}
+	}
+	target := n - 3
+	entries[target].Title = "RequestParser"
+	siteDir := t.TempDir()
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siteDir, "search-index.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := writeSearchShards(siteDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Docs != n {
+		t.Errorf("manifest lists %d docs, want %d", m.Docs, n)
+	}
+	handler := readSearchShard(t, siteDir, "ha")["handler"]
+	if len(handler) != 2*n {
+		t.Errorf("handler has %d postings, want %d", len(handler)/2, n)
+	}
+	if w, ok := hasPosting(handler, target); !ok || w != searchWeightDesc {
+		t.Errorf("handler posting for doc %d = %d, %v, want weight %d", target, w, ok, searchWeightDesc)
+	}
+	if w, ok := hasPosting(readSearchShard(t, siteDir, "re")["requestparser"], target); !ok || w != searchWeightTitle {
+		t.Errorf("requestparser posting for doc %d = %d, %v, want weight %d", target, w, ok, searchWeightTitle)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// serveReloadPath is the server-sent events endpoint open pages listen on.
+const serveReloadPath = "/__arch-docs/livereload"
+
+// servePollInterval is how often watched paths are checked for changes.
+const servePollInterval = 500 * time.Millisecond
+
+// liveReloadScript is injected into every served HTML page.
+const liveReloadScript = `<script>new EventSource("` + serveReloadPath + `").onmessage = function() { location.reload(); };</script>`
+
+// serveOptions are the flags of the serve subcommand.
+type serveOptions struct {
+	addr      string
+	graph     string
+	templates string
+	output    string
+	baseURL   string
+	config    string
+	workspace string
+}
+
+// runServe implements "arch-docs serve": it builds the site from a cached
+// graph.json, serves it under the base URL's path prefix, rebuilds whenever
+// the templates, graph or config change and reloads open pages. The content
+// is regenerated from the graph on every build, so watching the graph
+// covers it. Ctrl-C stops a running build and the server.
+func runServe(args []string) {
+	var opts serveOptions
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&opts.addr, "addr", "localhost:8080", "address to listen on")
+	fs.StringVar(&opts.graph, "graph", "graph.json", "cached graph.json (fetched from the API if missing); watched, as the content is regenerated from it on every build")
+	fs.StringVar(&opts.templates, "templates", "", "custom templates directory to build with and watch")
+	fs.StringVar(&opts.output, "output", "arch-docs-output", "output directory")
+	fs.StringVar(&opts.baseURL, "base-url", "", "site base URL; its path is served as the prefix (default http://<addr>)")
+	fs.StringVar(&opts.config, "config", "", "pssg.yaml overlay to build with and watch")
+	fs.StringVar(&opts.workspace, "workspace", ".", "repository to document")
+	fs.Parse(args)
+
+	if opts.baseURL == "" {
+		opts.baseURL = "http://" + opts.addr
+	}
+	for _, p := range []*string{&opts.graph, &opts.templates, &opts.output, &opts.config, &opts.workspace} {
+		if *p != "" {
+			abs, err := filepath.Abs(*p)
+			if err != nil {
+				fatal("%v", err)
+			}
+			*p = abs
+		}
+	}
+	prefix := extractPathPrefix(opts.baseURL)
+	runCtx = cancelOnSignal()
+
+	if err := serveBuild(runCtx, opts); err != nil {
+		fatal("Initial build failed: %v", err)
+	}
+
+	reload := &reloadHub{clients: map[chan struct{}]bool{}}
+	go watchAndRebuild(runCtx, opts, reload)
+
+	mux := http.NewServeMux()
+	mux.Handle(serveReloadPath, reload)
+	mux.Handle("/", &siteHandler{dir: opts.output, prefix: prefix})
+	srv := &http.Server{Addr: opts.addr, Handler: mux}
+	go func() {
+		<-runCtx.Done()
+		srv.Close()
+	}()
+	fmt.Printf("Serving %s at http://%s%s/\n", opts.output, opts.addr, prefix)
+	if err := srv.ListenAndServe(); err != nil && runCtx.Err() == nil {
+		fatal("%v", err)
+	}
+	os.Exit(exitCancelled)
+}
+
+// serveBuild runs the regular pipeline in a child process, so a failing
+// build (which exits via fatal) doesn't take the server down. Deploy inputs
+// are cleared; every other INPUT_* variable is passed through. Cancelling
+// ctx stops the build.
+func serveBuild(ctx context.Context, opts serveOptions) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	inputs := map[string]string{
+		"graph-file":     opts.graph,
+		"output-dir":     opts.output,
+		"templates-dir":  opts.templates,
+		"base-url":       opts.baseURL,
+		"pssg-config":    opts.config,
+		"incremental":    "true",
+		"s3-bucket":      "",
+		"publish-branch": "",
+	}
+	if key := os.Getenv("SUPERMODEL_API_KEY"); key != "" {
+		inputs["supermodel-api-key"] = key
+	}
+	env := append(os.Environ(), "GITHUB_WORKSPACE="+opts.workspace, "GITHUB_OUTPUT="+os.DevNull)
+	for name, value := range inputs {
+		upper := strings.ToUpper(name)
+		env = append(env, "INPUT_"+upper+"="+value, "INPUT_"+strings.ReplaceAll(upper, "-", "_")+"="+value)
+	}
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, exe)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = commandStopGrace
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	fmt.Printf("Built in %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// watchAndRebuild polls the watched paths and rebuilds once they have
+// stopped changing, then tells open pages to reload, until ctx is
+// cancelled.
+func watchAndRebuild(ctx context.Context, opts serveOptions, reload *reloadHub) {
+	var watched []string
+	for _, p := range []string{opts.templates, opts.graph, opts.config} {
+		if p != "" {
+			watched = append(watched, p)
+		}
+	}
+	last := snapshotPaths(watched)
+	pending := false
+	ticker := time.NewTicker(servePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := snapshotPaths(watched)
+		if cur != last {
+			// Wait for one quiet interval so editors finish writing.
+			last, pending = cur, true
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+		fmt.Println("Change detected, rebuilding")
+		if err := serveBuild(ctx, opts); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("::error::Rebuild failed: %v\n", err)
+			continue
+		}
+		reload.broadcast()
+	}
+}
+
+// snapshotPaths returns a string identifying the names, sizes and
+// modification times of every file under paths.
+func snapshotPaths(paths []string) string {
+	var entries []string
+	for _, root := range paths {
+		filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				entries = append(entries, fmt.Sprintf("%s:%d:%d", p, info.Size(), info.ModTime().UnixNano()))
+			}
+			return nil
+		})
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, "\n")
+}
+
+// reloadHub fans reload events out to connected pages.
+type reloadHub struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func (h *reloadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	h.clients[ch] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, ch)
+		h.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// broadcast tells every connected page to reload.
+func (h *reloadHub) broadcast() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// siteHandler serves the built site below its path prefix the way GitHub
+// Pages does, injecting the live reload script into HTML pages.
+type siteHandler struct {
+	dir    string
+	prefix string
+}
+
+func (h *siteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	if h.prefix != "" {
+		if p == "/" {
+			http.Redirect(w, r, h.prefix+"/", http.StatusFound)
+			return
+		}
+		if p != h.prefix && !strings.HasPrefix(p, h.prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		p = strings.TrimPrefix(p, h.prefix)
+	}
+
+	file := filepath.Join(h.dir, filepath.FromSlash(path.Clean("/"+p)))
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		file = filepath.Join(file, "index.html")
+	} else if os.IsNotExist(err) {
+		file += ".html"
+	}
+
+	if !strings.HasSuffix(file, ".html") {
+		http.ServeFile(w, r, file)
+		return
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if i := bytes.LastIndex(data, []byte("</body>")); i >= 0 {
+		data = append(data[:i], append([]byte(liveReloadScript), data[i:]...)...)
+	} else {
+		data = append(data, liveReloadScript...)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
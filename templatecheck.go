@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// graph2mdFields are the frontmatter fields graph2md writes. Not every
+// entity has every field; File entities have no start_line, for example.
+var graph2mdFields = []string{
+	"title", "description", "summary", "node_type", "language", "domain",
+	"subdomain", "top_directory", "extension", "tags", "file_path",
+	"start_line", "end_line", "import_count", "imported_by_count",
+	"call_count", "called_by_count", "function_count", "class_count",
+	"file_count", "mermaid_diagram", "graph_data", "arch_map", "repo_url",
+}
+
+// enrichedFields are the frontmatter fields arch-docs adds itself when
+// codeowners or git-history is enabled.
+var enrichedFields = []string{
+	"owners", "owners_text", "commit_count", "recent_churn", "last_modified",
+	"contributors", "contributors_text", "hotspot_score",
+}
+
+// TemplateIssue is a problem found by checkTemplates.
+type TemplateIssue struct {
+	Pos     string // file:line:col, or just the file
+	Error   bool   // false for warnings
+	Message string
+}
+
+// TemplateCheck is the result of checking a template set.
+type TemplateCheck struct {
+	Fields   []string // frontmatter fields referenced by any template
+	Sections []string // body sections referenced by the entity template
+	Issues   []TemplateIssue
+}
+
+// Errors returns the number of issues that are errors.
+func (c *TemplateCheck) Errors() int {
+	n := 0
+	for _, issue := range c.Issues {
+		if issue.Error {
+			n++
+		}
+	}
+	return n
+}
+
+// templateRefs collects what one parsed template references.
+type templateRefs struct {
+	fields    map[string]string // field -> position of first use
+	sections  map[string]string // section -> position of first use
+	templates map[string]string // called template -> position of first use
+	links     map[string]string // first segment of a root-relative link -> position of first use
+	faqs      bool              // calls .Entity.GetFAQs
+}
+
+// rootLinkPattern matches the first path segment of a root-relative href or
+// src in template text, e.g. node_type in href="/node_type/...".
+var rootLinkPattern = regexp.MustCompile(`(?:href|src)=["']?/([A-Za-z0-9_-]+)/`)
+
+// checkTemplates parses every template in tplDir, which must already hold
+// the generated partials, and cross-checks the frontmatter fields and body
+// sections they reference against graph2md's output and cfg. display maps
+// template names to the path shown in issues. extraFields are additional
+// frontmatter fields the content is known to have.
+func checkTemplates(tplDir string, cfg *PSSGConfig, display func(string) string, extraFields []string) (*TemplateCheck, error) {
+	check := &TemplateCheck{}
+	refs := map[string]*templateRefs{}
+	sectionVars := map[string]bool{}
+
+	err := filepath.Walk(tplDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(tplDir, p)
+		name := filepath.ToSlash(rel)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		// pssg provides more functions than arch-docs knows about, so calls
+		// to unknown functions are not reported.
+		t := parse.New(name)
+		t.Mode = parse.SkipFuncCheck
+		trees := map[string]*parse.Tree{}
+		if _, err := t.Parse(string(data), "", "", trees); err != nil {
+			// Errors read "template: name:line: message".
+			issue := TemplateIssue{Pos: display(name), Error: true, Message: err.Error()}
+			if line, msg, ok := strings.Cut(strings.TrimPrefix(err.Error(), "template: "+name+":"), ": "); ok {
+				issue.Pos += ":" + line
+				issue.Message = msg
+			}
+			check.Issues = append(check.Issues, issue)
+			// Keep the file defined so callers aren't reported as well.
+			refs[name] = &templateRefs{}
+			return nil
+		}
+		for treeName, tree := range trees {
+			r := &templateRefs{fields: map[string]string{}, sections: map[string]string{}, templates: map[string]string{}, links: map[string]string{}}
+			pos := func(n parse.Node) string {
+				loc, _ := tree.ErrorContext(n)
+				return display(name) + strings.TrimPrefix(loc, name)
+			}
+			if tree.Root != nil {
+				walkTemplate(tree.Root, r, sectionVars, pos)
+			}
+			refs[treeName] = r
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, f := range append(append(append([]string(nil), graph2mdFields...), enrichedFields...), extraFields...) {
+		known[f] = true
+	}
+	for _, t := range cfg.Taxonomies {
+		known[t.Field] = true
+	}
+	for _, f := range cfg.StructuredData.FieldMappings {
+		known[f] = true
+	}
+	configured := map[string]bool{}
+	for _, s := range cfg.Data.BodySections {
+		configured[s.Name] = true
+	}
+	// Links to the pages of a built-in taxonomy that isn't configured are
+	// broken; links to any other root directory can't be checked here.
+	taxonomies := map[string]bool{}
+	for _, t := range append(defaultTaxonomies, ownersTaxonomy) {
+		taxonomies[t.Name] = false
+	}
+	for _, t := range cfg.Taxonomies {
+		taxonomies[t.Name] = true
+	}
+
+	fields := map[string]bool{}
+	for _, name := range sortedRefKeys(refs) {
+		r := refs[name]
+		for _, field := range sortedStringKeys(r.fields) {
+			fields[field] = true
+			if !known[field] {
+				check.Issues = append(check.Issues, TemplateIssue{Pos: r.fields[field], Error: true, Message: fmt.Sprintf("unknown frontmatter field %q", field)})
+			}
+		}
+		for _, section := range sortedStringKeys(r.sections) {
+			if !configured[section] {
+				check.Issues = append(check.Issues, TemplateIssue{Pos: r.sections[section], Error: true, Message: fmt.Sprintf("unknown section %q (not in body_sections)", section)})
+			}
+		}
+		for _, dir := range sortedStringKeys(r.links) {
+			if on, ok := taxonomies[dir]; ok && !on {
+				check.Issues = append(check.Issues, TemplateIssue{Pos: r.links[dir], Error: true, Message: fmt.Sprintf("link to taxonomy %q, which is not configured", dir)})
+			}
+		}
+		for _, called := range sortedStringKeys(r.templates) {
+			if refs[called] == nil {
+				check.Issues = append(check.Issues, TemplateIssue{Pos: r.templates[called], Error: true, Message: fmt.Sprintf("missing partial %q", called)})
+			}
+		}
+	}
+	for f := range fields {
+		check.Fields = append(check.Fields, f)
+	}
+	sort.Strings(check.Fields)
+
+	// A section is used if a template the entity page reaches renders it.
+	entityTpl := cfg.Templates.Entity
+	if refs[entityTpl] == nil {
+		check.Issues = append(check.Issues, TemplateIssue{Pos: display(entityTpl), Error: true, Message: "entity template is missing"})
+		return check, nil
+	}
+	used := map[string]bool{}
+	faqs := false
+	seen := map[string]bool{}
+	queue := []string{entityTpl}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		r := refs[name]
+		if seen[name] || r == nil {
+			continue
+		}
+		seen[name] = true
+		for s := range r.sections {
+			used[s] = true
+		}
+		faqs = faqs || r.faqs
+		for called := range r.templates {
+			queue = append(queue, called)
+		}
+	}
+	for _, s := range cfg.Data.BodySections {
+		if used[s.Name] || s.Type == "faq" && faqs {
+			check.Sections = append(check.Sections, s.Name)
+			continue
+		}
+		check.Issues = append(check.Issues, TemplateIssue{
+			Pos:     display(entityTpl),
+			Message: fmt.Sprintf("section %q is configured but never rendered on entity pages", s.Name),
+		})
+	}
+	return check, nil
+}
+
+// walkTemplate records the fields, sections, templates and root-relative
+// links node references.
+// sectionVars holds the variables assigned .Entity.Sections.
+func walkTemplate(node parse.Node, r *templateRefs, sectionVars map[string]bool, pos func(parse.Node) string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, c := range n.Nodes {
+			walkTemplate(c, r, sectionVars, pos)
+		}
+	case *parse.TextNode:
+		for _, m := range rootLinkPattern.FindAllSubmatchIndex(n.Text, -1) {
+			dir := string(n.Text[m[2]:m[3]])
+			if _, seen := r.links[dir]; !seen {
+				r.links[dir] = pos(&parse.TextNode{NodeType: parse.NodeText, Pos: n.Pos + parse.Pos(m[0])})
+			}
+		}
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, r, sectionVars, pos)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, r, sectionVars, pos)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, r, sectionVars, pos)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, r, sectionVars, pos)
+	case *parse.TemplateNode:
+		if _, ok := r.templates[n.Name]; !ok {
+			r.templates[n.Name] = pos(n)
+		}
+		if n.Pipe != nil {
+			walkTemplate(n.Pipe, r, sectionVars, pos)
+		}
+	case *parse.PipeNode:
+		if len(n.Decl) == 1 && len(n.Cmds) == 1 && len(n.Cmds[0].Args) == 1 && isEntityChain(n.Cmds[0].Args[0], "Sections") {
+			sectionVars[n.Decl[0].Ident[0]] = true
+		}
+		for _, c := range n.Cmds {
+			walkTemplate(c, r, sectionVars, pos)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 0 {
+			return
+		}
+		if isEntityChain(n.Args[0], "GetFAQs") {
+			r.faqs = true
+		}
+		if method := entityMethod(n.Args[0]); strings.HasPrefix(method, "Get") && len(n.Args) > 1 {
+			if s, ok := n.Args[1].(*parse.StringNode); ok {
+				if _, seen := r.fields[s.Text]; !seen {
+					r.fields[s.Text] = pos(s)
+				}
+			}
+		}
+		if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "index" && len(n.Args) > 2 {
+			if isSectionsRef(n.Args[1], sectionVars) {
+				if s, ok := n.Args[2].(*parse.StringNode); ok {
+					if _, seen := r.sections[s.Text]; !seen {
+						r.sections[s.Text] = pos(s)
+					}
+				}
+			}
+		}
+		for _, a := range n.Args {
+			walkTemplate(a, r, sectionVars, pos)
+		}
+	}
+}
+
+// walkBranch walks the pipeline and both lists of an if, range or with.
+func walkBranch(n *parse.BranchNode, r *templateRefs, sectionVars map[string]bool, pos func(parse.Node) string) {
+	walkTemplate(n.Pipe, r, sectionVars, pos)
+	walkTemplate(n.List, r, sectionVars, pos)
+	if n.ElseList != nil {
+		walkTemplate(n.ElseList, r, sectionVars, pos)
+	}
+}
+
+// entityMethod returns the method or field name in ".Entity.Name" or
+// "$.Entity.Name", or "" if node is something else.
+func entityMethod(node parse.Node) string {
+	var ident []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		ident = n.Ident
+	case *parse.VariableNode:
+		if n.Ident[0] != "$" {
+			return ""
+		}
+		ident = n.Ident[1:]
+	default:
+		return ""
+	}
+	if len(ident) != 2 || ident[0] != "Entity" {
+		return ""
+	}
+	return ident[1]
+}
+
+// isEntityChain reports whether node is .Entity.<name>.
+func isEntityChain(node parse.Node, name string) bool {
+	return entityMethod(node) == name
+}
+
+// isSectionsRef reports whether node evaluates to .Entity.Sections.
+func isSectionsRef(node parse.Node, sectionVars map[string]bool) bool {
+	if v, ok := node.(*parse.VariableNode); ok && len(v.Ident) == 1 && sectionVars[v.Ident[0]] {
+		return true
+	}
+	return isEntityChain(node, "Sections")
+}
+
+// sortedRefKeys returns the keys of refs in order.
+func sortedRefKeys(refs map[string]*templateRefs) []string {
+	keys := make([]string, 0, len(refs))
+	for k := range refs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runTemplatesCheck implements "arch-docs templates check": it stages the
+// bundled templates with dir layered on top, generates the partials for the
+// given config and checks the result. It returns false if there were errors.
+func runTemplatesCheck(dir, configOverlay, taxonomyList string, extraFields []string) (bool, error) {
+	tmpDir, err := os.MkdirTemp("", "arch-docs-check-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tplDir := filepath.Join(tmpDir, "templates")
+	layers := []fs.FS{bundledTemplates()}
+	if dir != "" {
+		layers = append(layers, os.DirFS(dir))
+	}
+	for _, layer := range layers {
+		if err := stageTemplates(layer, tplDir); err != nil {
+			return false, fmt.Errorf("staging templates: %w", err)
+		}
+	}
+
+	baseCfg := newPSSGConfig("arch-docs", "http://localhost", "", "repo", filepath.Join(tmpDir, "content"), tplDir, filepath.Join(tmpDir, "site"), tmpDir)
+	if taxonomyList != "" {
+		baseCfg.Taxonomies = selectTaxonomies(taxonomyList)
+	}
+	cfg, err := generateConfig(filepath.Join(tmpDir, "pssg.yaml"), baseCfg, configOverlay)
+	if err != nil {
+		return false, err
+	}
+	if err := writeGeneratedPartials(tplDir, cfg, GeneratedPartials{}); err != nil {
+		return false, err
+	}
+
+	generated := map[string]bool{"_nav.html": true, "_entity_breadcrumb.html": true, "_entity_pills.html": true, "_sections.html": true, "_versions.html": true, "_theme.css": true, "_meta.html": true, "_data.html": true}
+	display := func(name string) string {
+		if generated[name] {
+			return "(generated) " + name
+		}
+		if dir != "" {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+				return filepath.Join(dir, filepath.FromSlash(name))
+			}
+		}
+		return "(bundled) " + name
+	}
+	check, err := checkTemplates(tplDir, cfg, display, extraFields)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Fields: %s\n", strings.Join(check.Fields, ", "))
+	fmt.Printf("Sections: %s\n", strings.Join(check.Sections, ", "))
+	for _, issue := range check.Issues {
+		level := "warning"
+		if issue.Error {
+			level = "error"
+		}
+		fmt.Printf("%s: %s: %s\n", issue.Pos, level, issue.Message)
+	}
+	errors := check.Errors()
+	fmt.Printf("%d errors, %d warnings\n", errors, len(check.Issues)-errors)
+	return errors == 0, nil
+}
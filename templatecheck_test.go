@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// stubEntity provides the entity methods the generated partials call.
+type stubEntity map[string]string
+
+func (e stubEntity) GetString(field string) string { return e[field] }
+
+func TestEntityTaxonomyPartials(t *testing.T) {
+	funcs := template.FuncMap{"slug": func(s string) string { return strings.ToLower(strings.ReplaceAll(s, " ", "-")) }}
+	render := func(partial string) string {
+		t.Helper()
+		tpl, err := template.New("p").Funcs(funcs).Parse(partial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		entity := stubEntity{"node_type": "Function", "language": "Go", "domain": "Data Access", "team": "Core", "tags": "x"}
+		if err := tpl.Execute(&b, map[string]interface{}{"Entity": entity}); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	all := selectTaxonomies("node_type,language,domain,subdomain,tags,team")
+	if got, want := render(entityBreadcrumbPartial(all)), `<a href="/node_type/function.html">Function</a><span class="sep">/</span>`; strings.TrimSpace(got) != want {
+		t.Errorf("breadcrumb = %q, want %q", got, want)
+	}
+	pills := render(entityPillsPartial(all))
+	for _, want := range []string{
+		`<a href="/node_type/function.html" class="pill pill-accent">Function</a>`,
+		`<a href="/language/go.html" class="pill pill-blue">Go</a>`,
+		`<a href="/domain/data-access.html" class="pill pill-green">Data Access</a>`,
+		`<a href="/team/core.html" class="pill">Core</a>`,
+	} {
+		if !strings.Contains(pills, want) {
+			t.Errorf("pills missing %s:\n%s", want, pills)
+		}
+	}
+	if strings.Contains(pills, "/subdomain/") || strings.Contains(pills, "/tags/") {
+		t.Errorf("pills link to an empty field or a multi-value taxonomy:\n%s", pills)
+	}
+
+	some := selectTaxonomies("domain")
+	if got := render(entityBreadcrumbPartial(some)); got != "" {
+		t.Errorf("breadcrumb without node_type = %q, want none", got)
+	}
+	if got := render(entityPillsPartial(some)); strings.Contains(got, "/node_type/") || strings.Contains(got, "/language/") {
+		t.Errorf("pills link to unconfigured taxonomies:\n%s", got)
+	}
+}
+
+func TestCheckTemplatesTaxonomyLinks(t *testing.T) {
+	tmp := t.TempDir()
+	tplDir := filepath.Join(tmp, "templates")
+	if err := stageTemplates(bundledTemplates(), tplDir); err != nil {
+		t.Fatal(err)
+	}
+	base := newPSSGConfig("arch-docs", "http://localhost", "", "repo", filepath.Join(tmp, "content"), tplDir, filepath.Join(tmp, "site"), tmp)
+	base.Taxonomies = selectTaxonomies("domain")
+	cfg, err := generateConfig(filepath.Join(tmp, "pssg.yaml"), base, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeGeneratedPartials(tplDir, cfg, GeneratedPartials{}); err != nil {
+		t.Fatal(err)
+	}
+	check := func() []TemplateIssue {
+		t.Helper()
+		c, err := checkTemplates(tplDir, cfg, func(name string) string { return name }, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Issues
+	}
+	if issues := check(); len(issues) != 0 {
+		t.Fatalf("bundled templates with only the domain taxonomy: %+v", issues)
+	}
+
+	custom := "<a href=\"/domain/x.html\">d</a>\n<a href='/language/go.html'>Go</a><a href=\"/all/\">all</a>"
+	if err := os.WriteFile(filepath.Join(tplDir, "extra.html"), []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	issues := check()
+	if len(issues) != 1 || issues[0].Pos != "extra.html:2:3" || !strings.Contains(issues[0].Message, `"language"`) {
+		t.Errorf("issues = %+v, want one for the language link at extra.html:2:3", issues)
+	}
+}
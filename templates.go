@@ -0,0 +1,299 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// navLabels are the header link labels for built-in taxonomies shown in the
+// site navigation. Custom taxonomies are always shown, using their label.
+var navLabels = map[string]string{
+	"node_type": "By Type",
+	"domain":    "Domains",
+	"language":  "Languages",
+	"tags":      "Tags",
+}
+
+// NavLink is an extra header link to a page arch-docs generates itself.
+type NavLink struct {
+	Href  string
+	Label string
+}
+
+// GeneratedPartials holds what arch-docs needs to know, beyond the pssg
+// config, to write the generated partials.
+type GeneratedPartials struct {
+	ExtraLinks []NavLink
+	RootPrefix string // path prefix of the output root, e.g. "/repo"
+	Version    string // "" for unversioned builds
+	NoIndex    bool   // ask search engines not to index the site
+	ThemeDir   string // directory the theme logo and favicon are relative to
+	DataExport string // data-export mode; the homepage links to the files unless off
+}
+
+// bundledTemplatesFS is the default template set, embedded so the binary
+// works outside the Docker image.
+//
+//go:embed all:templates
+var bundledTemplatesFS embed.FS
+
+// bundledTemplates returns the default template set rooted at its files.
+func bundledTemplates() fs.FS {
+	sub, err := fs.Sub(bundledTemplatesFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// stageTemplates copies the template set in src into dstDir so generated
+// partials can be added without touching the user's or bundled templates.
+// Staging several sets into the same dir layers them: later files replace
+// same-named earlier ones.
+func stageTemplates(src fs.FS, dstDir string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return fmt.Errorf("creating templates dir: %w", err)
+	}
+	return fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstDir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if path == templatesMarker {
+			return nil
+		}
+		data, err := fs.ReadFile(src, path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// copyFile copies a single file, creating parent directories as needed.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeGeneratedPartials writes the partials derived from the final pssg
+// config into the staged templates dir: _nav.html links to the configured
+// taxonomies and extra pages, _entity_breadcrumb.html and _entity_pills.html
+// link entity pages to their taxonomy pages, _sections.html renders the configured body
+// sections, _versions.html holds the version switcher, _meta.html the robots
+// directive and feed link, _data.html the homepage's data download links,
+// and the theme partials apply extra.theme.
+func writeGeneratedPartials(tplDir string, cfg *PSSGConfig, gp GeneratedPartials) error {
+	if err := os.WriteFile(filepath.Join(tplDir, "_nav.html"), []byte(navPartial(cfg.Taxonomies, gp.ExtraLinks)), 0644); err != nil {
+		return fmt.Errorf("writing _nav.html: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tplDir, "_entity_breadcrumb.html"), []byte(entityBreadcrumbPartial(cfg.Taxonomies)), 0644); err != nil {
+		return fmt.Errorf("writing _entity_breadcrumb.html: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tplDir, "_entity_pills.html"), []byte(entityPillsPartial(cfg.Taxonomies)), 0644); err != nil {
+		return fmt.Errorf("writing _entity_pills.html: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tplDir, "_sections.html"), []byte(sectionsPartial(cfg.Data.BodySections)), 0644); err != nil {
+		return fmt.Errorf("writing _sections.html: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tplDir, "_versions.html"), []byte(versionSwitcherPartial(gp.RootPrefix, gp.Version)), 0644); err != nil {
+		return fmt.Errorf("writing _versions.html: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tplDir, "_meta.html"), []byte(metaPartial(cfg, gp.NoIndex)), 0644); err != nil {
+		return fmt.Errorf("writing _meta.html: %w", err)
+	}
+	if gp.DataExport == "" {
+		gp.DataExport = dataOff
+	}
+	if err := os.WriteFile(filepath.Join(tplDir, "_data.html"), []byte(dataPartial(gp.DataExport)), 0644); err != nil {
+		return fmt.Errorf("writing _data.html: %w", err)
+	}
+	return writeThemePartials(tplDir, cfg.Extra.Theme, gp.ThemeDir)
+}
+
+// navPartial renders the header navigation links for the given taxonomies,
+// followed by the extra links.
+func navPartial(taxonomies []TaxonomyConfig, extraLinks []NavLink) string {
+	var b strings.Builder
+	for _, t := range taxonomies {
+		label, ok := navLabels[t.Name]
+		if !ok {
+			if isBuiltinTaxonomy(t.Name) {
+				continue
+			}
+			label = t.Label
+		}
+		fmt.Fprintf(&b, "<a href=\"/%s/index.html\">%s</a>\n", html.EscapeString(t.Name), html.EscapeString(label))
+	}
+	for _, l := range extraLinks {
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(l.Href), html.EscapeString(l.Label))
+	}
+	return b.String()
+}
+
+// pillClasses are the entity page pill classes of the built-in taxonomies
+// shown on entity pages. Custom single-value taxonomies get a plain pill.
+var pillClasses = map[string]string{
+	"node_type": "pill pill-accent",
+	"language":  "pill pill-blue",
+	"domain":    "pill pill-green",
+	"subdomain": "pill pill-orange",
+}
+
+// entityTaxonomyLink renders a link from an entity page to the page of its
+// value in taxonomy t, shown only when the entity has the field.
+func entityTaxonomyLink(t TaxonomyConfig, attrs, suffix string) string {
+	field := strconv.Quote(t.Field)
+	return fmt.Sprintf("{{if .Entity.GetString %s}}<a href=\"/%s/{{.Entity.GetString %s | slug}}.html\"%s>{{.Entity.GetString %s}}</a>%s{{end}}\n",
+		field, html.EscapeString(t.Name), field, attrs, field, suffix)
+}
+
+// entityBreadcrumbPartial renders the entity page breadcrumb link to the
+// entity's node type, if the node_type taxonomy is configured.
+func entityBreadcrumbPartial(taxonomies []TaxonomyConfig) string {
+	for _, t := range taxonomies {
+		if t.Name == "node_type" {
+			return entityTaxonomyLink(t, "", `<span class="sep">/</span>`)
+		}
+	}
+	return ""
+}
+
+// entityPillsPartial renders the entity page pills linking to the entity's
+// taxonomy pages. Built-in taxonomies without a pill class and multi-value
+// taxonomies are skipped.
+func entityPillsPartial(taxonomies []TaxonomyConfig) string {
+	var b strings.Builder
+	for _, t := range taxonomies {
+		class, ok := pillClasses[t.Name]
+		if !ok {
+			if isBuiltinTaxonomy(t.Name) || t.MultiValue {
+				continue
+			}
+			class = "pill"
+		}
+		b.WriteString(entityTaxonomyLink(t, fmt.Sprintf(` class="%s"`, class), ""))
+	}
+	return b.String()
+}
+
+// metaPartial renders the robots meta tag and, if RSS is enabled, the feed
+// link for every page head.
+func metaPartial(cfg *PSSGConfig, noIndex bool) string {
+	robots := "index, follow"
+	if noIndex {
+		robots = "noindex, nofollow"
+	}
+	s := fmt.Sprintf("<meta name=\"robots\" content=\"%s\">\n", robots)
+	if cfg.RSS.Enabled {
+		s += fmt.Sprintf("<link rel=\"alternate\" type=\"application/rss+xml\" title=\"%s\" href=\"/feed.xml\">\n", html.EscapeString(cfg.Site.Name))
+	}
+	return s
+}
+
+// sectionsPartial renders an entity page block for every list section.
+// FAQ sections are skipped; entity.html renders them via GetFAQs.
+func sectionsPartial(sections []SectionConfig) string {
+	var b strings.Builder
+	b.WriteString("{{$sections := .Entity.Sections}}\n")
+	for _, s := range sections {
+		if s.Type == "faq" {
+			continue
+		}
+		fmt.Fprintf(&b, `
+{{with index $sections %s}}
+<div class="entity-section">
+  <h2>%s</h2>
+  <ul>{{range .}}<li>{{. | safeHTML}}</li>{{end}}</ul>
+</div>
+{{end}}
+`, strconv.Quote(s.Name), html.EscapeString(s.Header))
+	}
+	return b.String()
+}
+
+// isBuiltinTaxonomy reports whether name is one of the default taxonomies.
+func isBuiltinTaxonomy(name string) bool {
+	for _, t := range defaultTaxonomies {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectTaxonomies returns the taxonomies named in a comma-separated list, in
+// the given order. Built-in names use their default definition; any other
+// name becomes a taxonomy over the frontmatter field of the same name.
+func selectTaxonomies(list string) []TaxonomyConfig {
+	var out []TaxonomyConfig
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		found := false
+		for _, t := range append(defaultTaxonomies, ownersTaxonomy) {
+			if t.Name == name {
+				out = append(out, t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, customTaxonomy(name))
+		}
+	}
+	return out
+}
+
+// customTaxonomy builds a taxonomy for a user-defined frontmatter field.
+func customTaxonomy(field string) TaxonomyConfig {
+	singular := titleCase(field)
+	return TaxonomyConfig{
+		Name:             field,
+		Label:            singular + "s",
+		LabelSingular:    singular,
+		Field:            field,
+		MinEntities:      1,
+		IndexDescription: "Browse by " + strings.ToLower(singular),
+	}
+}
+
+// titleCase turns a field name like "team_owner" into "Team Owner".
+func titleCase(field string) string {
+	words := strings.FieldsFunc(field, func(r rune) bool { return r == '_' || r == '-' })
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
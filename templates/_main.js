@@ -1,5 +1,21 @@
 function toSlug(s) { return s.toLowerCase().replace(/[^a-z0-9]+/g, "-").replace(/^-+|-+$/g, ""); }
 
+// Chart colors come from the CSS custom properties in _styles.css, so charts
+// follow the configured theme and light/dark mode.
+var palette = (function() {
+  var style = getComputedStyle(document.documentElement);
+  function v(name, fallback) { return style.getPropertyValue("--" + name).trim() || fallback; }
+  return {
+    bg: v("bg", "#0f1117"), bgCard: v("bg-card", "#1a1d27"), bgHover: v("bg-hover", "#22263a"),
+    border: v("border", "#2a2e3e"), text: v("text", "#e4e4e7"), textMuted: v("text-muted", "#9ca3af"),
+    accent: v("accent", "#6366f1"), accentLight: v("accent-light", "#818cf8"),
+    green: v("green", "#22c55e"), orange: v("orange", "#f59e0b"), orangeDeep: v("orange-deep", "#f97316"),
+    red: v("red", "#ef4444"), blue: v("blue", "#3b82f6"), purple: v("purple", "#a855f7"),
+    pink: v("pink", "#ec4899"), gray: v("gray", "#6b7280"),
+    font: v("font", "Inter,system-ui,sans-serif")
+  };
+})();
+
 window.addEventListener("load", function() {
 
   // --- Architecture Map ---
@@ -28,9 +44,9 @@ window.addEventListener("load", function() {
             var x = pad + i * (boxW + arrowW);
             var y = pad;
             var isLast = i === items.length - 1;
-            var fill = isLast ? "#6366f1" : "#1a1d27";
-            var stroke = isLast ? "#818cf8" : "#2a2e3e";
-            var textColor = isLast ? "#fff" : "#e4e4e7";
+            var fill = isLast ? palette.accent : palette.bgCard;
+            var stroke = isLast ? palette.accentLight : palette.border;
+            var textColor = isLast ? "#fff" : palette.text;
             var label = items[i].name || "";
             if (label.length > 16) label = label.substring(0, 14) + "..";
 
@@ -38,7 +54,7 @@ window.addEventListener("load", function() {
               svg += '<a href="/' + items[i].slug + '.html">';
             }
             svg += '<rect x="' + x + '" y="' + y + '" width="' + boxW + '" height="' + boxH + '" rx="6" fill="' + fill + '" stroke="' + stroke + '" stroke-width="1"/>';
-            svg += '<text x="' + (x + boxW / 2) + '" y="' + (y + boxH / 2 + 5) + '" text-anchor="middle" fill="' + textColor + '" font-size="12" font-family="Inter,system-ui,sans-serif">' + label + '</text>';
+            svg += '<text x="' + (x + boxW / 2) + '" y="' + (y + boxH / 2 + 5) + '" text-anchor="middle" fill="' + textColor + '" font-size="12" font-family="' + palette.font + '">' + label + '</text>';
             if (items[i].slug && !isLast) {
               svg += '</a>';
             }
@@ -46,8 +62,8 @@ window.addEventListener("load", function() {
             if (i < items.length - 1) {
               var ax = x + boxW + 4;
               var ay = y + boxH / 2;
-              svg += '<path d="M' + ax + ' ' + ay + ' L' + (ax + arrowW - 8) + ' ' + ay + '" stroke="#2a2e3e" stroke-width="1.5" fill="none"/>';
-              svg += '<polygon points="' + (ax + arrowW - 8) + ',' + (ay - 4) + ' ' + (ax + arrowW - 2) + ',' + ay + ' ' + (ax + arrowW - 8) + ',' + (ay + 4) + '" fill="#2a2e3e"/>';
+              svg += '<path d="M' + ax + ' ' + ay + ' L' + (ax + arrowW - 8) + ' ' + ay + '" stroke="' + palette.border + '" stroke-width="1.5" fill="none"/>';
+              svg += '<polygon points="' + (ax + arrowW - 8) + ',' + (ay - 4) + ' ' + (ax + arrowW - 2) + ',' + ay + ' ' + (ax + arrowW - 8) + ',' + (ay + 4) + '" fill="' + palette.border + '"/>';
             }
           }
 
@@ -75,12 +91,12 @@ window.addEventListener("load", function() {
         var height = 420;
 
         var typeColors = {
-          File: "#3b82f6", Function: "#22c55e", Class: "#f59e0b",
-          Type: "#ef4444", Domain: "#6366f1", Subdomain: "#a855f7", Directory: "#6b7280"
+          File: palette.blue, Function: palette.green, Class: palette.orange,
+          Type: palette.red, Domain: palette.accent, Subdomain: palette.purple, Directory: palette.gray
         };
         var edgeColors = {
-          imports: "#3b82f6", calls: "#22c55e", defines: "#f59e0b",
-          extends: "#ef4444", contains: "#6b7280", belongsTo: "#a855f7", partOf: "#6366f1"
+          imports: palette.blue, calls: palette.green, defines: palette.orange,
+          extends: palette.red, contains: palette.gray, belongsTo: palette.purple, partOf: palette.accent
         };
 
         // Compute node radius from enriched lineCount data
@@ -101,9 +117,9 @@ window.addEventListener("load", function() {
         var lgX = 4;
         legendKeys.forEach(function(t) {
           svg.append("rect").attr("x", lgX).attr("y", 4).attr("width", 10).attr("height", 10).attr("rx", 2)
-            .attr("fill", edgeColors[t] || "#2a2e3e");
-          svg.append("text").attr("x", lgX + 14).attr("y", 12).attr("fill", "#6b7280").attr("font-size", "10px")
-            .attr("font-family", "Inter,system-ui,sans-serif").text(t);
+            .attr("fill", edgeColors[t] || palette.border);
+          svg.append("text").attr("x", lgX + 14).attr("y", 12).attr("fill", palette.gray).attr("font-size", "10px")
+            .attr("font-family", palette.font).text(t);
           lgX += t.length * 6 + 26;
         });
 
@@ -114,7 +130,7 @@ window.addEventListener("load", function() {
           .force("collision", d3.forceCollide().radius(function(d) { return nodeR(d) + 8; }));
 
         var link = svg.append("g").selectAll("line").data(graphData.edges).enter().append("line")
-          .attr("stroke", function(d) { return edgeColors[d.type] || "#2a2e3e"; })
+          .attr("stroke", function(d) { return edgeColors[d.type] || palette.border; })
           .attr("stroke-opacity", 0.6).attr("stroke-width", 1.5);
 
         var node = svg.append("g").selectAll("g").data(graphData.nodes).enter().append("g")
@@ -133,7 +149,7 @@ window.addEventListener("load", function() {
 
         node.append("circle")
           .attr("r", nodeR)
-          .attr("fill", function(d) { return typeColors[d.type] || "#6b7280"; })
+          .attr("fill", function(d) { return typeColors[d.type] || palette.gray; })
           .attr("stroke", function(d) { return d.slug === centerSlug ? "#fff" : "none"; })
           .attr("stroke-width", function(d) { return d.slug === centerSlug ? 2.5 : 0; })
           .attr("opacity", function(d) { return d.slug === centerSlug ? 1 : 0.85; });
@@ -143,14 +159,14 @@ window.addEventListener("load", function() {
           .text(function(d) { return d.lc; })
           .attr("text-anchor", "middle").attr("y", 4).attr("fill", "#fff")
           .attr("font-size", "9px").attr("font-weight", "600")
-          .attr("font-family", "Inter,system-ui,sans-serif");
+          .attr("font-family", palette.font);
 
         node.append("text")
           .text(function(d) { var l = d.label || ""; return l.length > 22 ? l.substring(0, 20) + ".." : l; })
           .attr("x", 0)
           .attr("y", function(d) { return -(nodeR(d) + 4); })
-          .attr("text-anchor", "middle").attr("fill", "#9ca3af")
-          .attr("font-size", "11px").attr("font-family", "Inter,system-ui,sans-serif");
+          .attr("text-anchor", "middle").attr("fill", palette.textMuted)
+          .attr("font-size", "11px").attr("font-family", palette.font);
 
         // Enriched tooltip
         node.append("title").text(function(d) {
@@ -191,15 +207,15 @@ window.addEventListener("load", function() {
 
       // Build metrics from compact keys
       var metricDefs = [
-        { key: "lc", label: "Lines of Code", color: "#6366f1" },
-        { key: "co", label: "Calls Out", color: "#3b82f6" },
-        { key: "cb", label: "Called By", color: "#22c55e" },
-        { key: "ic", label: "Imports", color: "#f59e0b" },
-        { key: "ib", label: "Imported By", color: "#a855f7" },
-        { key: "fn", label: "Functions", color: "#ec4899" },
-        { key: "cl", label: "Classes", color: "#ef4444" },
-        { key: "tc", label: "Types", color: "#f97316" },
-        { key: "fc", label: "Files", color: "#6b7280" }
+        { key: "lc", label: "Lines of Code", color: palette.accent },
+        { key: "co", label: "Calls Out", color: palette.blue },
+        { key: "cb", label: "Called By", color: palette.green },
+        { key: "ic", label: "Imports", color: palette.orange },
+        { key: "ib", label: "Imported By", color: palette.purple },
+        { key: "fn", label: "Functions", color: palette.pink },
+        { key: "cl", label: "Classes", color: palette.red },
+        { key: "tc", label: "Types", color: palette.orangeDeep },
+        { key: "fc", label: "Files", color: palette.gray }
       ];
       var metrics = metricDefs.filter(function(d) { return ep[d.key] > 0; })
         .map(function(d) { return { label: d.label, value: ep[d.key], color: d.color }; });
@@ -210,8 +226,8 @@ window.addEventListener("load", function() {
         .sort(function(a, b) { return b.count - a.count; });
 
       var epEdgeColors = {
-        calls: "#3b82f6", defines: "#22c55e", belongsTo: "#a855f7",
-        imports: "#f59e0b", extends: "#ef4444", contains: "#6b7280", partOf: "#6366f1"
+        calls: palette.blue, defines: palette.green, belongsTo: palette.purple,
+        imports: palette.orange, extends: palette.red, contains: palette.gray, partOf: palette.accent
       };
 
       var hasMetrics = metrics.length > 0;
@@ -233,12 +249,12 @@ window.addEventListener("load", function() {
         metrics.forEach(function(m, i) {
           var y = yOff + i * 32 + 4;
           svg.append("text").attr("x", labelW - 6).attr("y", y + 13).attr("text-anchor", "end")
-            .attr("fill", "#9ca3af").attr("font-size", "12px").attr("font-family", "Inter,system-ui,sans-serif").text(m.label);
+            .attr("fill", palette.textMuted).attr("font-size", "12px").attr("font-family", palette.font).text(m.label);
           svg.append("rect").attr("x", labelW).attr("y", y).attr("width", Math.max(barScale(m.value), 4)).attr("height", 20)
             .attr("rx", 3).attr("fill", m.color).attr("opacity", 0.85);
           svg.append("text").attr("x", labelW + Math.max(barScale(m.value), 4) + 6).attr("y", y + 14)
-            .attr("fill", "#e4e4e7").attr("font-size", "13px").attr("font-weight", "600")
-            .attr("font-family", "Inter,system-ui,sans-serif").text(m.value);
+            .attr("fill", palette.text).attr("font-size", "13px").attr("font-weight", "600")
+            .attr("font-family", palette.font).text(m.value);
         });
         yOff += metricsH;
       }
@@ -248,21 +264,21 @@ window.addEventListener("load", function() {
         var stackW = Math.min(epW - 130, 500);
         var stackScale = d3.scaleLinear().domain([0, totalEdgeCount]).range([0, stackW]);
         var sx = 100, sy = yOff + 6;
-        svg.append("text").attr("x", 0).attr("y", sy + 2).attr("fill", "#6b7280").attr("font-size", "11px")
-          .attr("font-weight", "600").attr("font-family", "Inter,system-ui,sans-serif").text("RELATIONSHIPS");
+        svg.append("text").attr("x", 0).attr("y", sy + 2).attr("fill", palette.gray).attr("font-size", "11px")
+          .attr("font-weight", "600").attr("font-family", palette.font).text("RELATIONSHIPS");
         var cx = sx;
         edgeTypes.forEach(function(e, i) {
           var w = Math.max(stackScale(e.count), 3);
           svg.append("rect").attr("x", cx).attr("y", sy - 6).attr("width", w).attr("height", 18)
-            .attr("rx", i === 0 ? 3 : 0).attr("fill", epEdgeColors[e.type] || "#6b7280").attr("opacity", 0.85);
+            .attr("rx", i === 0 ? 3 : 0).attr("fill", epEdgeColors[e.type] || palette.gray).attr("opacity", 0.85);
           cx += w;
         });
         var ly = sy + 18, lx = sx;
         edgeTypes.forEach(function(e) {
           svg.append("rect").attr("x", lx).attr("y", ly).attr("width", 8).attr("height", 8).attr("rx", 2)
-            .attr("fill", epEdgeColors[e.type] || "#6b7280");
-          svg.append("text").attr("x", lx + 12).attr("y", ly + 7).attr("fill", "#9ca3af").attr("font-size", "10px")
-            .attr("font-family", "Inter,system-ui,sans-serif").text(e.type + " " + e.count);
+            .attr("fill", epEdgeColors[e.type] || palette.gray);
+          svg.append("text").attr("x", lx + 12).attr("y", ly + 7).attr("fill", palette.textMuted).attr("font-size", "10px")
+            .attr("font-family", palette.font).text(e.type + " " + e.count);
           lx += e.type.length * 6.5 + 36;
           if (lx > epW - 60) { lx = sx; ly += 16; }
         });
@@ -271,16 +287,16 @@ window.addEventListener("load", function() {
 
       if (ep.sl > 0 && ep.el > 0) {
         var fy = yOff + 8, fw = Math.min(epW - 130, 500), fx = 100;
-        svg.append("text").attr("x", 0).attr("y", fy + 2).attr("fill", "#6b7280").attr("font-size", "11px")
-          .attr("font-weight", "600").attr("font-family", "Inter,system-ui,sans-serif").text("FILE POSITION");
+        svg.append("text").attr("x", 0).attr("y", fy + 2).attr("fill", palette.gray).attr("font-size", "11px")
+          .attr("font-weight", "600").attr("font-family", palette.font).text("FILE POSITION");
         svg.append("rect").attr("x", fx).attr("y", fy - 5).attr("width", fw).attr("height", 14).attr("rx", 3)
-          .attr("fill", "#1a1d27").attr("stroke", "#2a2e3e").attr("stroke-width", 1);
+          .attr("fill", palette.bgCard).attr("stroke", palette.border).attr("stroke-width", 1);
         var est = Math.max(ep.el * 1.15, ep.el + 20);
         var hx = fx + (ep.sl / est) * fw, hw = Math.max(((ep.el - ep.sl) / est) * fw, 3);
         svg.append("rect").attr("x", hx).attr("y", fy - 5).attr("width", hw).attr("height", 14).attr("rx", 2)
-          .attr("fill", "#6366f1").attr("opacity", 0.8);
-        svg.append("text").attr("x", fx + fw + 6).attr("y", fy + 4).attr("fill", "#9ca3af").attr("font-size", "10px")
-          .attr("font-family", "Inter,system-ui,sans-serif").text("L" + ep.sl + "–" + ep.el);
+          .attr("fill", palette.accent).attr("opacity", 0.8);
+        svg.append("text").attr("x", fx + fw + 6).attr("y", fy + 4).attr("fill", palette.textMuted).attr("font-size", "10px")
+          .attr("font-family", palette.font).text("L" + ep.sl + "–" + ep.el);
       }
     } catch (e) { console.error("Entity profile chart error:", e); }
   }
@@ -294,7 +310,7 @@ window.addEventListener("load", function() {
       if (archData && archData.nodes && archData.nodes.length > 1) {
         var aoW = archOverEl.clientWidth || 800;
         var aoH = 420;
-        var aoTypeColors = { root: "#6366f1", domain: "#3b82f6", subdomain: "#a855f7" };
+        var aoTypeColors = { root: palette.accent, domain: palette.blue, subdomain: palette.purple };
         var aoSvg = d3.select(archOverEl).append("svg").attr("width", aoW).attr("height", aoH);
 
         var maxCount = d3.max(archData.nodes, function(d) { return d.count; }) || 1;
@@ -309,7 +325,7 @@ window.addEventListener("load", function() {
           .force("collision", d3.forceCollide().radius(function(d) { return radiusScale(d.count) + 12; }));
 
         var aoLink = aoSvg.append("g").selectAll("line").data(archData.links).enter().append("line")
-          .attr("stroke", "#2a2e3e").attr("stroke-opacity", 0.6).attr("stroke-width", 1.5);
+          .attr("stroke", palette.border).attr("stroke-opacity", 0.6).attr("stroke-width", 1.5);
 
         var aoNode = aoSvg.append("g").selectAll("g").data(archData.nodes).enter().append("g")
           .style("cursor", function(d) { return d.slug ? "pointer" : "default"; })
@@ -327,25 +343,25 @@ window.addEventListener("load", function() {
 
         aoNode.append("circle")
           .attr("r", function(d) { return d.type === "root" ? 24 : radiusScale(d.count); })
-          .attr("fill", function(d) { return aoTypeColors[d.type] || "#6b7280"; })
+          .attr("fill", function(d) { return aoTypeColors[d.type] || palette.gray; })
           .attr("opacity", 0.9)
-          .attr("stroke", function(d) { return d.type === "root" ? "#818cf8" : "none"; })
+          .attr("stroke", function(d) { return d.type === "root" ? palette.accentLight : "none"; })
           .attr("stroke-width", function(d) { return d.type === "root" ? 2 : 0; });
 
         aoNode.append("text")
           .text(function(d) { var l = d.name; return l.length > 20 ? l.substring(0, 18) + ".." : l; })
           .attr("x", 0)
           .attr("y", function(d) { return (d.type === "root" ? 24 : radiusScale(d.count)) + 14; })
-          .attr("text-anchor", "middle").attr("fill", "#9ca3af")
+          .attr("text-anchor", "middle").attr("fill", palette.textMuted)
           .attr("font-size", function(d) { return d.type === "root" ? "13px" : "11px"; })
           .attr("font-weight", function(d) { return d.type === "root" ? "600" : "400"; })
-          .attr("font-family", "Inter,system-ui,sans-serif");
+          .attr("font-family", palette.font);
 
         aoNode.filter(function(d) { return d.type !== "root" && d.count > 0; }).append("text")
           .text(function(d) { return d.count; })
           .attr("text-anchor", "middle").attr("y", 4).attr("fill", "#fff")
           .attr("font-size", "11px").attr("font-weight", "600")
-          .attr("font-family", "Inter,system-ui,sans-serif");
+          .attr("font-family", palette.font);
 
         aoNode.on("click", function(event, d) {
           if (d.slug) window.location.href = "/" + d.slug + ".html";
@@ -382,15 +398,15 @@ window.addEventListener("load", function() {
       if (children.length > 0) {
         var root = d3.hierarchy({ name: "root", children: children }).sum(function(d) { return d.value || 0; }).sort(function(a, b) { return b.value - a.value; });
         d3.treemap().size([hpW, hpH]).padding(3).round(true)(root);
-        var colors = ["#6366f1", "#3b82f6", "#22c55e", "#f59e0b", "#ef4444", "#a855f7", "#ec4899", "#6b7280"];
+        var colors = [palette.accent, palette.blue, palette.green, palette.orange, palette.red, palette.purple, palette.pink, palette.gray];
         var svg = d3.select(hpChartEl).append("svg").attr("width", hpW).attr("height", hpH);
         var cell = svg.selectAll("g").data(root.leaves()).enter().append("g")
           .attr("transform", function(d) { return "translate(" + d.x0 + "," + d.y0 + ")"; })
           .style("cursor", "pointer")
           .on("click", function(event, d) { if (d.data.slug) window.location.href = "/" + d.data.slug + "/index.html"; });
         cell.append("rect").attr("width", function(d) { return d.x1 - d.x0; }).attr("height", function(d) { return d.y1 - d.y0; }).attr("rx", 4).attr("fill", function(d, i) { return colors[i % colors.length]; }).attr("opacity", 0.85);
-        cell.append("text").attr("x", 8).attr("y", 20).attr("fill", "#fff").attr("font-size", "13px").attr("font-weight", "600").attr("font-family", "Inter,system-ui,sans-serif").text(function(d) { var w = d.x1 - d.x0; return w > 60 ? d.data.name : ""; });
-        cell.append("text").attr("x", 8).attr("y", 38).attr("fill", "rgba(255,255,255,0.7)").attr("font-size", "12px").attr("font-family", "Inter,system-ui,sans-serif").text(function(d) { var w = d.x1 - d.x0; return w > 50 ? d.data.value : ""; });
+        cell.append("text").attr("x", 8).attr("y", 20).attr("fill", "#fff").attr("font-size", "13px").attr("font-weight", "600").attr("font-family", palette.font).text(function(d) { var w = d.x1 - d.x0; return w > 60 ? d.data.name : ""; });
+        cell.append("text").attr("x", 8).attr("y", 38).attr("fill", "rgba(255,255,255,0.7)").attr("font-size", "12px").attr("font-family", palette.font).text(function(d) { var w = d.x1 - d.x0; return w > 50 ? d.data.value : ""; });
         cell.append("title").text(function(d) { return d.data.name + ": " + d.data.value + " entries"; });
       }
     } catch (e) { console.error("Homepage chart error:", e); }
@@ -404,7 +420,7 @@ window.addEventListener("load", function() {
     try {
       var hubData = JSON.parse(hubDataEl.textContent.trim());
       var distributions = hubData.distributions || {};
-      var hubColors = ["#6366f1", "#3b82f6", "#22c55e", "#f59e0b", "#ef4444", "#a855f7", "#ec4899", "#6b7280"];
+      var hubColors = [palette.accent, palette.blue, palette.green, palette.orange, palette.red, palette.purple, palette.pink, palette.gray];
       var dimLabels = { node_type: "Node Types", language: "Languages", domain: "Domains", extension: "File Extensions" };
       var dimOrder = ["node_type", "language", "domain", "extension"];
 
@@ -429,18 +445,18 @@ window.addEventListener("load", function() {
         var svg = d3.select(hubChartEl).append("svg").attr("width", hubW).attr("height", hubH);
         var cx = Math.min(hubH / 2 + 10, hubW * 0.3);
         var g = svg.append("g").attr("transform", "translate(" + cx + "," + (hubH / 2) + ")");
-        var arcs = g.selectAll("path").data(pie(dist)).enter().append("path").attr("d", arc).attr("fill", function(d, i) { return hubColors[i % hubColors.length]; }).attr("stroke", "#0f1117").attr("stroke-width", 2).style("cursor", "pointer")
+        var arcs = g.selectAll("path").data(pie(dist)).enter().append("path").attr("d", arc).attr("fill", function(d, i) { return hubColors[i % hubColors.length]; }).attr("stroke", palette.bg).attr("stroke-width", 2).style("cursor", "pointer")
           .on("click", function(event, d) { window.location.href = "/" + bestKey + "/" + toSlug(d.data.name) + ".html"; });
         arcs.append("title").text(function(d) { return d.data.name + ": " + d.data.count; });
-        g.append("text").attr("text-anchor", "middle").attr("y", 6).attr("fill", "#e4e4e7").attr("font-size", "20px").attr("font-weight", "700").attr("font-family", "Inter,system-ui,sans-serif").text(hubData.totalEntities || "");
-        svg.append("text").attr("x", cx).attr("y", hubH - 4).attr("text-anchor", "middle").attr("fill", "#6b7280").attr("font-size", "11px").attr("font-family", "Inter,system-ui,sans-serif").text(dimLabels[bestKey] || bestKey);
+        g.append("text").attr("text-anchor", "middle").attr("y", 6).attr("fill", palette.text).attr("font-size", "20px").attr("font-weight", "700").attr("font-family", palette.font).text(hubData.totalEntities || "");
+        svg.append("text").attr("x", cx).attr("y", hubH - 4).attr("text-anchor", "middle").attr("fill", palette.gray).attr("font-size", "11px").attr("font-family", palette.font).text(dimLabels[bestKey] || bestKey);
         var legendX = cx + radius + 20;
         dist.forEach(function(d, i) {
           if (i >= 8) return;
           var ly = 16 + i * 22;
           var lg = svg.append("g").style("cursor", "pointer").on("click", function() { window.location.href = "/" + bestKey + "/" + toSlug(d.name) + ".html"; });
           lg.append("rect").attr("x", legendX).attr("y", ly).attr("width", 10).attr("height", 10).attr("rx", 2).attr("fill", hubColors[i % hubColors.length]);
-          lg.append("text").attr("x", legendX + 16).attr("y", ly + 9).attr("fill", "#9ca3af").attr("font-size", "11px").attr("font-family", "Inter,system-ui,sans-serif").text(d.name + " (" + d.count + ")");
+          lg.append("text").attr("x", legendX + 16).attr("y", ly + 9).attr("fill", palette.textMuted).attr("font-size", "11px").attr("font-family", palette.font).text(d.name + " (" + d.count + ")");
         });
       } else {
         var profileBars = [];
@@ -459,12 +475,12 @@ window.addEventListener("load", function() {
           var pbMax = d3.max(profileBars, function(d) { return d.count; }) || 1;
           var pbScale = d3.scaleLinear().domain([0, pbMax]).range([0, pbW - pbLabelW - 100]);
           var svg = d3.select(hubChartEl).append("svg").attr("width", pbW).attr("height", pbH);
-          svg.append("text").attr("x", 0).attr("y", 14).attr("fill", "#6b7280").attr("font-size", "11px").attr("font-family", "Inter,system-ui,sans-serif").text(hubData.entryName + " — " + hubData.totalEntities + " entities");
+          svg.append("text").attr("x", 0).attr("y", 14).attr("fill", palette.gray).attr("font-size", "11px").attr("font-family", palette.font).text(hubData.entryName + " — " + hubData.totalEntities + " entities");
           profileBars.forEach(function(d, i) {
             var y = 24 + i * (pbBarH + pbGap);
-            svg.append("text").attr("x", pbLabelW - 6).attr("y", y + pbBarH / 2 + 4).attr("text-anchor", "end").attr("fill", "#9ca3af").attr("font-size", "12px").attr("font-family", "Inter,system-ui,sans-serif").text(d.name);
+            svg.append("text").attr("x", pbLabelW - 6).attr("y", y + pbBarH / 2 + 4).attr("text-anchor", "end").attr("fill", palette.textMuted).attr("font-size", "12px").attr("font-family", palette.font).text(d.name);
             svg.append("rect").attr("x", pbLabelW).attr("y", y).attr("width", Math.max(pbScale(d.count), 4)).attr("height", pbBarH).attr("rx", 3).attr("fill", hubColors[i % hubColors.length]).attr("opacity", 0.85);
-            svg.append("text").attr("x", pbLabelW + Math.max(pbScale(d.count), 4) + 6).attr("y", y + pbBarH / 2 + 4).attr("fill", "#e4e4e7").attr("font-size", "12px").attr("font-weight", "600").attr("font-family", "Inter,system-ui,sans-serif").text(d.detail);
+            svg.append("text").attr("x", pbLabelW + Math.max(pbScale(d.count), 4) + 6).attr("y", y + pbBarH / 2 + 4).attr("fill", palette.text).attr("font-size", "12px").attr("font-weight", "600").attr("font-family", palette.font).text(d.detail);
           });
         }
       }
@@ -479,12 +495,12 @@ window.addEventListener("load", function() {
         var teLabelW = Math.min(teW * 0.45, 200);
         var teMax = d3.max(topEnts, function(d) { return d.lines; }) || 1;
         var teScale = d3.scaleLinear().domain([0, teMax]).range([0, teW - teLabelW - 60]);
-        var typeColors = { Function: "#22c55e", Class: "#f59e0b", File: "#3b82f6", Type: "#ef4444", Domain: "#6366f1", Subdomain: "#a855f7" };
+        var typeColors = { Function: palette.green, Class: palette.orange, File: palette.blue, Type: palette.red, Domain: palette.accent, Subdomain: palette.purple };
 
         var teSvg = d3.select(hubSecEl).append("svg").attr("width", teW).attr("height", teH);
-        teSvg.append("text").attr("x", 0).attr("y", 12).attr("fill", "#6b7280").attr("font-size", "11px").attr("font-weight", "600")
+        teSvg.append("text").attr("x", 0).attr("y", 12).attr("fill", palette.gray).attr("font-size", "11px").attr("font-weight", "600")
           .attr("text-transform", "uppercase").attr("letter-spacing", "0.04em")
-          .attr("font-family", "Inter,system-ui,sans-serif").text("LARGEST BY LINES OF CODE");
+          .attr("font-family", palette.font).text("LARGEST BY LINES OF CODE");
 
         topEnts.forEach(function(d, i) {
           var y = 22 + i * (teBarH + teGap);
@@ -493,11 +509,11 @@ window.addEventListener("load", function() {
           var g = teSvg.append("g").style("cursor", "pointer")
             .on("click", function() { window.location.href = "/" + d.slug + ".html"; });
           g.append("text").attr("x", teLabelW - 6).attr("y", y + teBarH / 2 + 4).attr("text-anchor", "end")
-            .attr("fill", "#9ca3af").attr("font-size", "11px").attr("font-family", "Inter,system-ui,sans-serif").text(label);
+            .attr("fill", palette.textMuted).attr("font-size", "11px").attr("font-family", palette.font).text(label);
           g.append("rect").attr("x", teLabelW).attr("y", y).attr("width", Math.max(teScale(d.lines), 3)).attr("height", teBarH)
-            .attr("rx", 3).attr("fill", typeColors[d.type] || "#6366f1").attr("opacity", 0.85);
+            .attr("rx", 3).attr("fill", typeColors[d.type] || palette.accent).attr("opacity", 0.85);
           g.append("text").attr("x", teLabelW + Math.max(teScale(d.lines), 3) + 5).attr("y", y + teBarH / 2 + 4)
-            .attr("fill", "#6b7280").attr("font-size", "10px").attr("font-family", "Inter,system-ui,sans-serif").text(d.lines);
+            .attr("fill", palette.gray).attr("font-size", "10px").attr("font-family", palette.font).text(d.lines);
           g.append("title").text(d.name + " (" + d.type + ") — " + d.lines + " lines");
         });
       }
@@ -525,9 +541,9 @@ window.addEventListener("load", function() {
           var y = i * (barH + gap);
           var label = d.name.length > 22 ? d.name.substring(0, 20) + ".." : d.name;
           var g = svg.append("g").style("cursor", "pointer").on("click", function() { if (taxKey) window.location.href = "/" + taxKey + "/" + toSlug(d.name) + ".html"; });
-          g.append("text").attr("x", labelW - 8).attr("y", y + barH / 2 + 4).attr("text-anchor", "end").attr("fill", "#9ca3af").attr("font-size", "13px").attr("font-family", "Inter,system-ui,sans-serif").text(label);
-          g.append("rect").attr("x", labelW).attr("y", y).attr("width", Math.max(barScale(d.count), 4)).attr("height", barH).attr("rx", 3).attr("fill", "#6366f1").attr("opacity", 0.85);
-          g.append("text").attr("x", labelW + Math.max(barScale(d.count), 4) + 8).attr("y", y + barH / 2 + 4).attr("fill", "#9ca3af").attr("font-size", "12px").attr("font-family", "Inter,system-ui,sans-serif").text(d.count);
+          g.append("text").attr("x", labelW - 8).attr("y", y + barH / 2 + 4).attr("text-anchor", "end").attr("fill", palette.textMuted).attr("font-size", "13px").attr("font-family", palette.font).text(label);
+          g.append("rect").attr("x", labelW).attr("y", y).attr("width", Math.max(barScale(d.count), 4)).attr("height", barH).attr("rx", 3).attr("fill", palette.accent).attr("opacity", 0.85);
+          g.append("text").attr("x", labelW + Math.max(barScale(d.count), 4) + 8).attr("y", y + barH / 2 + 4).attr("fill", palette.textMuted).attr("font-size", "12px").attr("font-family", palette.font).text(d.count);
         });
       }
     } catch (e) { console.error("Taxonomy chart error:", e); }
@@ -543,15 +559,15 @@ window.addEventListener("load", function() {
       if (types.length > 0) {
         var aeW = aeChartEl.clientWidth || 800;
         var aeH = 320;
-        var aeColors = ["#6366f1", "#3b82f6", "#22c55e", "#f59e0b", "#ef4444", "#a855f7", "#ec4899", "#6b7280"];
+        var aeColors = [palette.accent, palette.blue, palette.green, palette.orange, palette.red, palette.purple, palette.pink, palette.gray];
         var root = d3.hierarchy({ children: types }).sum(function(d) { return d.count || 0; });
         d3.pack().size([aeW, aeH]).padding(4)(root);
         var svg = d3.select(aeChartEl).append("svg").attr("width", aeW).attr("height", aeH);
         var node = svg.selectAll("g").data(root.leaves()).enter().append("g").attr("transform", function(d) { return "translate(" + d.x + "," + d.y + ")"; })
           .style("cursor", "pointer").on("click", function(event, d) { window.location.href = "/" + "node_type/" + toSlug(d.data.name) + ".html"; });
-        node.append("circle").attr("r", function(d) { return d.r; }).attr("fill", function(d, i) { return aeColors[i % aeColors.length]; }).attr("opacity", 0.8).attr("stroke", "#0f1117").attr("stroke-width", 1);
-        node.append("text").attr("text-anchor", "middle").attr("y", -4).attr("fill", "#fff").attr("font-size", function(d) { return Math.max(10, Math.min(16, d.r / 3)) + "px"; }).attr("font-weight", "600").attr("font-family", "Inter,system-ui,sans-serif").text(function(d) { return d.r > 25 ? d.data.name : ""; });
-        node.append("text").attr("text-anchor", "middle").attr("y", 12).attr("fill", "rgba(255,255,255,0.7)").attr("font-size", "11px").attr("font-family", "Inter,system-ui,sans-serif").text(function(d) { return d.r > 20 ? d.data.count : ""; });
+        node.append("circle").attr("r", function(d) { return d.r; }).attr("fill", function(d, i) { return aeColors[i % aeColors.length]; }).attr("opacity", 0.8).attr("stroke", palette.bg).attr("stroke-width", 1);
+        node.append("text").attr("text-anchor", "middle").attr("y", -4).attr("fill", "#fff").attr("font-size", function(d) { return Math.max(10, Math.min(16, d.r / 3)) + "px"; }).attr("font-weight", "600").attr("font-family", palette.font).text(function(d) { return d.r > 25 ? d.data.name : ""; });
+        node.append("text").attr("text-anchor", "middle").attr("y", 12).attr("fill", "rgba(255,255,255,0.7)").attr("font-size", "11px").attr("font-family", palette.font).text(function(d) { return d.r > 20 ? d.data.count : ""; });
         node.append("title").text(function(d) { return d.data.name + ": " + d.data.count; });
       }
     } catch (e) { console.error("All entities chart error:", e); }
@@ -578,9 +594,9 @@ window.addEventListener("load", function() {
           var y = i * (ltBarH + ltGap);
           var label = d.name.length > 22 ? d.name.substring(0, 20) + ".." : d.name;
           var g = svg.append("g").style("cursor", "pointer").on("click", function() { if (ltKey) window.location.href = "/" + ltKey + "/" + toSlug(d.name) + ".html"; });
-          g.append("text").attr("x", ltLabelW - 8).attr("y", y + ltBarH / 2 + 4).attr("text-anchor", "end").attr("fill", "#9ca3af").attr("font-size", "13px").attr("font-family", "Inter,system-ui,sans-serif").text(label);
-          g.append("rect").attr("x", ltLabelW).attr("y", y).attr("width", Math.max(ltScale(d.count), 4)).attr("height", ltBarH).attr("rx", 3).attr("fill", "#6366f1").attr("opacity", 0.85);
-          g.append("text").attr("x", ltLabelW + Math.max(ltScale(d.count), 4) + 8).attr("y", y + ltBarH / 2 + 4).attr("fill", "#9ca3af").attr("font-size", "12px").attr("font-family", "Inter,system-ui,sans-serif").text(d.count);
+          g.append("text").attr("x", ltLabelW - 8).attr("y", y + ltBarH / 2 + 4).attr("text-anchor", "end").attr("fill", palette.textMuted).attr("font-size", "13px").attr("font-family", palette.font).text(label);
+          g.append("rect").attr("x", ltLabelW).attr("y", y).attr("width", Math.max(ltScale(d.count), 4)).attr("height", ltBarH).attr("rx", 3).attr("fill", palette.accent).attr("opacity", 0.85);
+          g.append("text").attr("x", ltLabelW + Math.max(ltScale(d.count), 4) + 8).attr("y", y + ltBarH / 2 + 4).attr("fill", palette.textMuted).attr("font-size", "12px").attr("font-family", palette.font).text(d.count);
         });
       }
     } catch (e) { console.error("Letter chart error:", e); }
@@ -593,13 +609,13 @@ window.addEventListener("load", function() {
         startOnLoad: false,
         theme: "dark",
         themeVariables: {
-          primaryColor: "#6366f1", primaryTextColor: "#e4e4e7",
-          primaryBorderColor: "#818cf8", lineColor: "#2a2e3e",
-          secondaryColor: "#1a1d27", tertiaryColor: "#22263a",
-          background: "#1a1d27", mainBkg: "#1a1d27",
-          nodeBorder: "#2a2e3e", clusterBkg: "#0f1117",
-          clusterBorder: "#2a2e3e", titleColor: "#e4e4e7",
-          edgeLabelBackground: "#1a1d27"
+          primaryColor: palette.accent, primaryTextColor: palette.text,
+          primaryBorderColor: palette.accentLight, lineColor: palette.border,
+          secondaryColor: palette.bgCard, tertiaryColor: palette.bgHover,
+          background: palette.bgCard, mainBkg: palette.bgCard,
+          nodeBorder: palette.border, clusterBkg: palette.bg,
+          clusterBorder: palette.border, titleColor: palette.text,
+          edgeLabelBackground: palette.bgCard
         }
       });
       mermaid.run();
@@ -618,7 +634,13 @@ window.addEventListener("load", function() {
   var toggleBtn = document.querySelector(".search-toggle");
   if (!overlay || !input || !resultsEl) return;
 
-  var index = null;
+  // The index is sharded by arch-docs (search.go): search/manifest.json lists
+  // the token shards, which are only fetched once a query needs them.
+  var manifest = null;
+  var base = "";
+  var shards = {};
+  var chunks = {};
+  var seq = 0;
   var activeIdx = -1;
   var results = [];
 
@@ -628,7 +650,7 @@ window.addEventListener("load", function() {
     resultsEl.innerHTML = "";
     activeIdx = -1;
     input.focus();
-    if (!index) loadIndex();
+    if (!manifest) loadIndex();
   }
 
   function closeSearch() {
@@ -637,43 +659,94 @@ window.addEventListener("load", function() {
   }
 
   function loadIndex() {
-    fetch("/search-index.json")
-      .then(function(r) { return r.json(); })
-      .then(function(data) { index = data; })
+    fetch("/search/manifest.json")
+      .then(function(r) {
+        if (!r.ok) throw new Error(r.status);
+        base = r.url.replace(/manifest\.json(\?.*)?$/, "");
+        return r.json();
+      })
+      .then(function(data) { manifest = data; if (input.value) search(input.value.trim()); })
       .catch(function() { resultsEl.innerHTML = '<div class="search-no-results">Failed to load search index.</div>'; });
   }
 
-  function search(query) {
-    if (!index || !query) { resultsEl.innerHTML = ""; results = []; activeIdx = -1; return; }
-    var q = query.toLowerCase();
-    var tokens = q.split(/\s+/).filter(Boolean);
-
-    var scored = [];
-    for (var i = 0; i < index.length; i++) {
-      var e = index[i];
-      var haystack = (e.t + " " + (e.d || "") + " " + (e.n || "") + " " + (e.l || "") + " " + (e.m || "")).toLowerCase();
-      var titleLower = e.t.toLowerCase();
-      var allMatch = true;
-      for (var j = 0; j < tokens.length; j++) {
-        if (haystack.indexOf(tokens[j]) === -1) { allMatch = false; break; }
-      }
-      if (!allMatch) continue;
-
-      var score = 0;
-      if (titleLower === q) score += 100;
-      else if (titleLower.indexOf(q) === 0) score += 50;
-      else if (titleLower.indexOf(q) >= 0) score += 20;
-      for (var k = 0; k < tokens.length; k++) {
-        if (titleLower.indexOf(tokens[k]) >= 0) score += 5;
-      }
-
-      scored.push({ entry: e, score: score });
+  // loadGz fetches a gzip-compressed JSON file of the index.
+  function loadGz(cache, name) {
+    if (!cache[name]) {
+      cache[name] = fetch(base + name)
+        .then(function(r) {
+          if (!r.ok) throw new Error(r.status);
+          return r.arrayBuffer();
+        })
+        .then(function(buf) {
+          var bytes = new Uint8Array(buf);
+          // Some hosts serve .gz files already decoded.
+          if (bytes[0] !== 0x1f || bytes[1] !== 0x8b) return JSON.parse(new TextDecoder().decode(bytes));
+          return new Response(new Blob([bytes]).stream().pipeThrough(new DecompressionStream("gzip"))).json();
+        })
+        .catch(function(err) { delete cache[name]; throw err; });
     }
+    return cache[name];
+  }
+
+  // tokenize matches searchTokens in search.go.
+  function tokenize(s) {
+    return s.replace(/([\p{Ll}\p{N}])(\p{Lu})/gu, "$1 $2").replace(/(\p{Lu})(\p{Lu}\p{Ll})/gu, "$1 $2")
+      .toLowerCase().split(/[^\p{L}\p{N}]+/u)
+      .filter(function(t) { return Array.from(t).length > 1; });
+  }
 
-    scored.sort(function(a, b) { return b.score - a.score; });
-    results = scored.slice(0, 20);
-    activeIdx = results.length > 0 ? 0 : -1;
-    renderResults();
+  function shardKey(token) {
+    var k = token.slice(0, 2);
+    return /^[a-z0-9]{2}$/.test(k) ? k : "_";
+  }
+
+  function search(query) {
+    var id = ++seq;
+    var terms = tokenize(query);
+    if (!manifest || !terms.length) { results = []; activeIdx = -1; renderResults(); return; }
+
+    Promise.all(terms.map(function(term) {
+      var key = shardKey(term);
+      return manifest.shards.indexOf(key) >= 0 ? loadGz(shards, "t-" + key + ".json.gz") : {};
+    }))
+      .then(function(loaded) {
+        // Every term must match a token of the entry, exactly or as a
+        // prefix; scores add up across terms.
+        var total = null;
+        terms.forEach(function(term, i) {
+          var best = {};
+          var shard = loaded[i];
+          for (var token in shard) {
+            if (token.indexOf(term) !== 0) continue;
+            var factor = token === term ? 1 : 0.6;
+            var postings = shard[token];
+            for (var j = 0; j < postings.length; j += 2) {
+              var score = postings[j + 1] * factor;
+              if (!(best[postings[j]] >= score)) best[postings[j]] = score;
+            }
+          }
+          if (total === null) { total = best; return; }
+          var next = {};
+          for (var doc in total) if (doc in best) next[doc] = total[doc] + best[doc];
+          total = next;
+        });
+        var docs = Object.keys(total).map(Number)
+          .sort(function(a, b) { return total[b] - total[a] || a - b; })
+          .slice(0, 20);
+        return Promise.all(docs.map(function(doc) {
+          return loadGz(chunks, "d-" + Math.floor(doc / manifest.chunk) + ".json.gz")
+            .then(function(chunk) { return { entry: chunk[doc % manifest.chunk] }; });
+        }));
+      })
+      .then(function(found) {
+        if (id !== seq) return;
+        results = found;
+        activeIdx = results.length > 0 ? 0 : -1;
+        renderResults();
+      })
+      .catch(function() {
+        if (id === seq) resultsEl.innerHTML = '<div class="search-no-results">Failed to load search index.</div>';
+      });
   }
 
   function renderResults() {
@@ -742,3 +815,34 @@ window.addEventListener("load", function() {
     return tag === "INPUT" || tag === "TEXTAREA" || tag === "SELECT" || el.isContentEditable;
   }
 })();
+
+// --- Version Switcher ---
+(function() {
+  var switcher = document.querySelector(".version-switcher");
+  if (!switcher) return;
+  var root = switcher.getAttribute("data-root") || "/";
+  var current = switcher.getAttribute("data-version");
+  var select = switcher.querySelector(".version-select");
+  if (!select) return;
+
+  fetch(root + "versions.json")
+    .then(function(r) { return r.json(); })
+    .then(function(manifest) {
+      select.innerHTML = "";
+      (manifest.versions || []).forEach(function(v) {
+        var opt = document.createElement("option");
+        opt.value = v.name;
+        opt.textContent = v.name + (v.name === manifest.latest ? " (latest)" : "");
+        if (v.name === current) opt.selected = true;
+        select.appendChild(opt);
+      });
+    })
+    .catch(function() {});
+
+  select.addEventListener("change", function() {
+    var base = root + current + "/";
+    var path = window.location.pathname;
+    var rest = path.indexOf(base) === 0 ? path.slice(base.length) : "";
+    window.location.href = root + select.value + "/" + rest;
+  });
+})();
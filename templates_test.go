@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// The head partials receive the page's data, so custom heads can use it.
+func TestHeadPartialsReceivePageData(t *testing.T) {
+	head, err := fs.ReadFile(bundledTemplates(), "_head.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := template.Must(template.New("page").Parse(`{{template "_head.html" .}}`))
+	template.Must(tpl.New("_head.html").Parse(string(head)))
+	template.Must(tpl.New("_meta.html").Parse(`<meta name="x" content="{{.Site.Name}}">`))
+	template.Must(tpl.New("_favicon.html").Parse(`<link rel="icon" href="{{.Site.BaseURL}}/favicon.svg">`))
+	template.Must(tpl.New("_custom_head.html").Parse(`<meta property="og:site_name" content="{{.Site.Name}}">`))
+
+	var b strings.Builder
+	data := map[string]interface{}{"Site": SiteInfo{Name: "Acme", BaseURL: "https://acme.example"}}
+	if err := tpl.ExecuteTemplate(&b, "page", data); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<meta name="x" content="Acme">`,
+		`<link rel="icon" href="https://acme.example/favicon.svg">`,
+		`<meta property="og:site_name" content="Acme">`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("head missing %s:\n%s", want, b.String())
+		}
+	}
+}
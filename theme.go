@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Theme modes for extra.theme.mode.
+const (
+	themeDark  = "dark"
+	themeLight = "light"
+	themeAuto  = "auto"
+)
+
+// themeColorPattern accepts hex colors, color names and CSS color
+// functions, and nothing that could end the declaration.
+var themeColorPattern = regexp.MustCompile(`^(?:#[0-9a-fA-F]{3,8}|[a-zA-Z]+|(?:rgba?|hsla?|oklch|oklab)\([0-9a-zA-Z.,%/\s-]+\))$`)
+
+// themeImageTypes are the image types accepted for the logo and favicon.
+var themeImageTypes = map[string]string{
+	".svg":  "image/svg+xml",
+	".png":  "image/png",
+	".ico":  "image/x-icon",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+}
+
+// lightPalette replaces the dark defaults of _styles.css in light mode.
+const lightPalette = `  color-scheme: light;
+  --bg: #ffffff;
+  --bg-card: #f7f7f9;
+  --bg-hover: #eceef3;
+  --bg-code: #f4f5f7;
+  --bg-deep: #eef0f6;
+  --border: #e2e4ea;
+  --text: #18181b;
+  --text-muted: #5f6672;
+  --accent-light: #4f46e5;
+  --gray: #71717a;
+`
+
+// validateTheme checks extra.theme, resolving the logo and favicon against
+// baseDir.
+func validateTheme(t ThemeConfig, baseDir string) error {
+	switch t.Mode {
+	case "", themeDark, themeLight, themeAuto:
+	default:
+		return fmt.Errorf("invalid mode %q: use dark, light or auto", t.Mode)
+	}
+	for name, c := range map[string]string{"primary": t.Primary, "accent": t.Accent} {
+		if c != "" && !themeColorPattern.MatchString(c) {
+			return fmt.Errorf("invalid %s color %q", name, c)
+		}
+	}
+	for name, f := range map[string]string{"font": t.Font, "mono_font": t.MonoFont} {
+		if strings.ContainsAny(f, ";{}<>\\") {
+			return fmt.Errorf("invalid %s %q", name, f)
+		}
+	}
+	for name, p := range map[string]string{"logo": t.Logo, "favicon": t.Favicon} {
+		if p == "" {
+			continue
+		}
+		if _, ok := themeImageTypes[strings.ToLower(filepath.Ext(p))]; !ok {
+			return fmt.Errorf("%s %s must be an svg, png, ico, jpg or webp image", name, p)
+		}
+		if _, err := os.Stat(themePath(baseDir, p)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// themeCSS renders the CSS custom properties for t. _styles.css includes it
+// after its own :root block, so these declarations win.
+func themeCSS(t ThemeConfig) string {
+	var b strings.Builder
+	switch t.Mode {
+	case themeLight:
+		b.WriteString(":root {\n" + lightPalette + "}\n")
+	case themeAuto:
+		b.WriteString(":root { color-scheme: light dark; }\n")
+		b.WriteString("@media (prefers-color-scheme: light) {\n:root {\n" + lightPalette + "}\n}\n")
+	}
+
+	var vars []string
+	if t.Primary != "" {
+		vars = append(vars, "  --accent: "+t.Primary+";")
+	}
+	if t.Accent != "" {
+		vars = append(vars, "  --accent-light: "+t.Accent+";")
+	}
+	if t.Font != "" {
+		vars = append(vars, "  --font: "+t.Font+";")
+	}
+	if t.MonoFont != "" {
+		vars = append(vars, "  --mono: "+t.MonoFont+";")
+	}
+	if len(vars) > 0 {
+		b.WriteString(":root {\n" + strings.Join(vars, "\n") + "\n}\n")
+	}
+	return b.String()
+}
+
+// themeAssetURL returns the site path a theme image is published at, with a
+// content hash so browsers and incremental builds pick up a changed file.
+func themeAssetURL(kind, baseDir, src string) (string, error) {
+	data, err := os.ReadFile(themePath(baseDir, src))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "/" + themeAssetName(kind, src) + "?v=" + hex.EncodeToString(sum[:])[:8], nil
+}
+
+// themeAssetName is the file name a theme image is published under.
+func themeAssetName(kind, src string) string {
+	return kind + strings.ToLower(filepath.Ext(src))
+}
+
+// themePath resolves a theme image path against baseDir.
+func themePath(baseDir, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(baseDir, p)
+}
+
+// writeThemePartials writes _theme.css and, if the theme sets them,
+// replaces the bundled _logo.html and _favicon.html.
+func writeThemePartials(tplDir string, t ThemeConfig, baseDir string) error {
+	if err := os.WriteFile(filepath.Join(tplDir, "_theme.css"), []byte(themeCSS(t)), 0644); err != nil {
+		return fmt.Errorf("writing _theme.css: %w", err)
+	}
+	if t.Logo != "" {
+		u, err := themeAssetURL("logo", baseDir, t.Logo)
+		if err != nil {
+			return err
+		}
+		partial := fmt.Sprintf("<img src=\"%s\" alt=\"\" class=\"site-logo\">\n", html.EscapeString(u))
+		if err := os.WriteFile(filepath.Join(tplDir, "_logo.html"), []byte(partial), 0644); err != nil {
+			return fmt.Errorf("writing _logo.html: %w", err)
+		}
+	}
+	if t.Favicon != "" {
+		u, err := themeAssetURL("favicon", baseDir, t.Favicon)
+		if err != nil {
+			return err
+		}
+		typ := themeImageTypes[strings.ToLower(filepath.Ext(t.Favicon))]
+		partial := fmt.Sprintf("<link rel=\"icon\" href=\"%s\" type=\"%s\">\n", html.EscapeString(u), typ)
+		if err := os.WriteFile(filepath.Join(tplDir, "_favicon.html"), []byte(partial), 0644); err != nil {
+			return fmt.Errorf("writing _favicon.html: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeThemeAssets copies the theme's logo and favicon into outputDir.
+func writeThemeAssets(t ThemeConfig, baseDir, outputDir string) error {
+	for kind, src := range map[string]string{"logo": t.Logo, "favicon": t.Favicon} {
+		if src == "" {
+			continue
+		}
+		if err := copyFile(themePath(baseDir, src), filepath.Join(outputDir, themeAssetName(kind, src))); err != nil {
+			return fmt.Errorf("copying %s: %w", kind, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionsManifest is the name of the manifest in the output root.
+const versionsManifest = "versions.json"
+
+// VersionManifest lists every version built into the output directory.
+type VersionManifest struct {
+	Latest   string         `json:"latest"`
+	Versions []VersionEntry `json:"versions"`
+}
+
+// VersionEntry is a single built version.
+type VersionEntry struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Stable  bool   `json:"stable"`
+	BuiltAt string `json:"built_at"`
+}
+
+// resolveVersion turns the version input into a path-safe version name.
+// "auto" derives it from the tag or branch that triggered the workflow.
+func resolveVersion(input string) (string, error) {
+	v := input
+	if v == "auto" {
+		v = os.Getenv("GITHUB_REF_NAME")
+		if v == "" {
+			return "", fmt.Errorf("version is auto but GITHUB_REF_NAME is not set")
+		}
+	}
+	v = strings.ReplaceAll(v, "/", "-")
+	for _, r := range v {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return "", fmt.Errorf("invalid version %q: only letters, digits, '.', '-' and '_' are allowed", input)
+		}
+	}
+	if v == "." || v == ".." {
+		return "", fmt.Errorf("invalid version %q", input)
+	}
+	return v, nil
+}
+
+// parseSemver parses "v1.2.3" or "1.2" into numeric parts and a prerelease
+// suffix. ok is false if v is not a semantic version.
+func parseSemver(v string) (parts [3]int, pre string, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		pre, v = v[i:], v[:i]
+		if j := strings.IndexByte(pre, '+'); j >= 0 {
+			pre = pre[:j]
+		}
+	}
+	nums := strings.Split(v, ".")
+	if len(nums) == 0 || len(nums) > 3 {
+		return parts, "", false
+	}
+	for i, n := range nums {
+		x, err := strconv.Atoi(n)
+		if err != nil || x < 0 {
+			return parts, "", false
+		}
+		parts[i] = x
+	}
+	return parts, pre, true
+}
+
+// isStableVersion reports whether v is a semantic version without a
+// prerelease suffix.
+func isStableVersion(v string) bool {
+	_, pre, ok := parseSemver(v)
+	return ok && pre == ""
+}
+
+// versionLess orders semantic versions newest first, followed by any other
+// names (branches) alphabetically.
+func versionLess(a, b string) bool {
+	pa, prea, oka := parseSemver(a)
+	pb, preb, okb := parseSemver(b)
+	if oka != okb {
+		return oka
+	}
+	if !oka {
+		return a < b
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] > pb[i]
+		}
+	}
+	if (prea == "") != (preb == "") {
+		return prea == ""
+	}
+	return comparePrerelease(prea, preb) > 0
+}
+
+// comparePrerelease compares prerelease suffixes such as "-rc.10" by
+// semver precedence: dot-separated identifiers from left to right, numeric
+// ones numerically and below alphanumeric ones; if all preceding identifiers
+// are equal, the longer list is greater. It returns -1, 0 or 1.
+func comparePrerelease(a, b string) int {
+	ia := strings.Split(strings.TrimPrefix(a, "-"), ".")
+	ib := strings.Split(strings.TrimPrefix(b, "-"), ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		na, errA := strconv.ParseUint(ia[i], 10, 64)
+		nb, errB := strconv.ParseUint(ib[i], 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				return cmp.Compare(na, nb)
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		case ia[i] != ib[i]:
+			return cmp.Compare(ia[i], ib[i])
+		}
+	}
+	return cmp.Compare(len(ia), len(ib))
+}
+
+// readVersionManifest reads versions.json from outputDir, returning an empty
+// manifest if there is none yet.
+func readVersionManifest(outputDir string) (*VersionManifest, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, versionsManifest))
+	if os.IsNotExist(err) {
+		return &VersionManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m VersionManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", versionsManifest, err)
+	}
+	return &m, nil
+}
+
+// addVersion records a build of version in the manifest and recomputes the
+// latest version.
+func (m *VersionManifest) addVersion(version, pathPrefix string, builtAt time.Time) {
+	entry := VersionEntry{
+		Name:    version,
+		Path:    pathPrefix + "/" + version + "/",
+		Stable:  isStableVersion(version),
+		BuiltAt: builtAt.UTC().Format(time.RFC3339),
+	}
+	replaced := false
+	for i := range m.Versions {
+		if m.Versions[i].Name == version {
+			m.Versions[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		m.Versions = append(m.Versions, entry)
+	}
+	m.updateLatest()
+}
+
+// mergeVersions adds the entries of other that m doesn't have and
+// recomputes the latest version.
+func (m *VersionManifest) mergeVersions(other *VersionManifest) {
+	have := map[string]bool{}
+	for _, v := range m.Versions {
+		have[v.Name] = true
+	}
+	for _, v := range other.Versions {
+		if !have[v.Name] {
+			m.Versions = append(m.Versions, v)
+		}
+	}
+	if len(m.Versions) > 0 {
+		m.updateLatest()
+	}
+}
+
+// updateLatest sorts the versions and picks the latest one: the newest
+// stable release, or the most recent build when there is no stable release
+// yet.
+func (m *VersionManifest) updateLatest() {
+	sort.SliceStable(m.Versions, func(i, j int) bool {
+		return versionLess(m.Versions[i].Name, m.Versions[j].Name)
+	})
+
+	m.Latest = ""
+	for _, v := range m.Versions {
+		if v.Stable {
+			m.Latest = v.Name
+			break
+		}
+	}
+	if m.Latest == "" {
+		newest := m.Versions[0]
+		for _, v := range m.Versions {
+			if v.BuiltAt > newest.BuiltAt {
+				newest = v
+			}
+		}
+		m.Latest = newest.Name
+	}
+}
+
+// writeVersionRoot writes versions.json and a root index.html redirecting to
+// the latest version into outputDir.
+func writeVersionRoot(outputDir, baseURL, pathPrefix string, m *VersionManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, versionsManifest), data, 0644); err != nil {
+		return err
+	}
+
+	target := html.EscapeString(pathPrefix + "/" + m.Latest + "/")
+	canonical := html.EscapeString(strings.TrimRight(baseURL, "/") + "/" + m.Latest + "/")
+	redirect := fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Redirecting to %[2]s</title>
+<meta http-equiv="refresh" content="0; url=%[1]s">
+<link rel="canonical" href="%[3]s">
+<meta name="robots" content="noindex">
+</head>
+<body>
+<p>Redirecting to the latest version: <a href="%[1]s">%[2]s</a></p>
+</body>
+</html>
+`, target, html.EscapeString(m.Latest), canonical)
+	return os.WriteFile(filepath.Join(outputDir, "index.html"), []byte(redirect), 0644)
+}
+
+// versionSwitcherPartial renders _versions.html. It is empty for unversioned
+// builds; otherwise _main.js fills the select from versions.json at the
+// output root. data-root is deliberately not an href so path rewriting
+// leaves it alone.
+func versionSwitcherPartial(pathPrefix, version string) string {
+	if version == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<div class="version-switcher" data-root="%s/" data-version="%s">
+  <select class="version-select" aria-label="Documentation version">
+    <option value="%s" selected>%s</option>
+  </select>
+</div>
+`, html.EscapeString(pathPrefix), html.EscapeString(version), html.EscapeString(version), html.EscapeString(version))
+}
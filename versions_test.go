@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestVersionLess(t *testing.T) {
+	// Newest first: semver §11 precedence, then branches alphabetically.
+	want := []string{
+		"v2.0.0",
+		"v1.10.0",
+		"v1.2.0",
+		"v1.0.0",
+		"v1.0.0-rc.10",
+		"v1.0.0-rc.9",
+		"v1.0.0-rc.1",
+		"v1.0.0-beta.11",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha",
+		"develop",
+		"main",
+	}
+	for seed := int64(0); seed < 5; seed++ {
+		got := append([]string(nil), want...)
+		rand.New(rand.NewSource(seed)).Shuffle(len(got), func(i, j int) { got[i], got[j] = got[j], got[i] })
+		sort.Slice(got, func(i, j int) bool { return versionLess(got[i], got[j]) })
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("sorted\n got: %v\nwant: %v", got, want)
+		}
+	}
+}
+
+func TestComparePrerelease(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"-rc.10", "-rc.9", 1},
+		{"-rc.1", "-rc.1", 0},
+		{"-1", "-alpha", -1},
+		{"-alpha.1", "-alpha", 1},
+		{"-alpha.beta", "-alpha.1", 1},
+		{"-beta", "-alpha.beta", 1},
+		{"-rc.1x", "-rc.2", 1},
+	}
+	for _, tt := range tests {
+		if got := comparePrerelease(tt.a, tt.b); got != tt.want {
+			t.Errorf("comparePrerelease(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := comparePrerelease(tt.b, tt.a); got != -tt.want {
+			t.Errorf("comparePrerelease(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}